@@ -0,0 +1,16 @@
+resource "koyeb_domain" "my-domain" {
+  name = "www.example.tld"
+}
+
+resource "cloudflare_record" "my-domain" {
+  zone_id = var.cloudflare_zone_id
+  type    = koyeb_domain.my-domain.dns_records[0].type
+  name    = koyeb_domain.my-domain.dns_records[0].name
+  value   = koyeb_domain.my-domain.dns_records[0].value
+}
+
+resource "koyeb_domain_verification" "my-domain" {
+  domain_id = koyeb_domain.my-domain.id
+
+  depends_on = [cloudflare_record.my-domain]
+}
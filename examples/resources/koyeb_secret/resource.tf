@@ -1,4 +1,13 @@
 resource "koyeb_secret" "simple-secret" {
   name  = "secret-name"
   value = "secret-value"
-}
\ No newline at end of file
+}
+resource "koyeb_secret" "generated-secret" {
+  name             = "generated-secret-name"
+  rotation_trigger = "2022-10-01"
+
+  generate {
+    length  = 48
+    special = false
+  }
+}
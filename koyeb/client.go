@@ -0,0 +1,241 @@
+package koyeb
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/koyeb/koyeb-api-client-go/api/v1/koyeb"
+	"github.com/koyeb/koyeb-cli/pkg/koyeb/idmapper"
+)
+
+// Client is the meta shared by every resource and data source of a provider
+// instance. It wraps the API client with the account the token belongs to and
+// shared caches of name to ID resolutions and of the services using each
+// secret.
+type Client struct {
+	*koyeb.APIClient
+
+	// User is the user the token belongs to
+	User koyeb.User
+	// OrganizationID is the ID of the organization the resources are managed in
+	OrganizationID string
+	// Organization is the organization the resources are managed in
+	Organization koyeb.Organization
+
+	ids         *idCache
+	secretUsage *secretUsageCache
+}
+
+func newClient(apiClient *koyeb.APIClient) *Client {
+	return &Client{
+		APIClient:   apiClient,
+		ids:         newIDCache(),
+		secretUsage: &secretUsageCache{},
+	}
+}
+
+// loadAccount resolves the user and the organization the token belongs to.
+func (c *Client) loadAccount(ctx context.Context) error {
+	user, _, err := c.ProfileApi.GetCurrentUser(ctx).Execute()
+	if err != nil {
+		return fmt.Errorf("cannot retrieve the current user: %w", err)
+	}
+	c.User = user.GetUser()
+	c.OrganizationID = c.User.GetDefaultOrganizationId()
+
+	if c.OrganizationID != "" {
+		organization, _, err := c.OrganizationApi.GetOrganization(ctx, c.OrganizationID).Execute()
+		if err != nil {
+			return fmt.Errorf("cannot retrieve organization %s: %w", c.OrganizationID, err)
+		}
+		c.Organization = organization.GetOrganization()
+	}
+
+	return nil
+}
+
+// AppName returns the name of the app with the given ID.
+func (c *Client) AppName(ctx context.Context, id string) (string, error) {
+	res, _, err := c.AppsApi.GetApp(ctx, id).Execute()
+	if err != nil {
+		return "", err
+	}
+
+	return res.App.GetName(), nil
+}
+
+// ListServices pages through all the services, optionally filtered by app.
+func (c *Client) ListServices(ctx context.Context, appId string) ([]koyeb.ServiceListItem, error) {
+	services := []koyeb.ServiceListItem{}
+	limit := 100
+
+	for offset := 0; ; offset += limit {
+		req := c.ServicesApi.ListServices(ctx).Limit(strconv.Itoa(limit)).Offset(strconv.Itoa(offset))
+		if appId != "" {
+			req = req.AppId(appId)
+		}
+
+		res, _, err := req.Execute()
+		if err != nil {
+			return nil, err
+		}
+
+		services = append(services, res.GetServices()...)
+
+		if len(res.GetServices()) < limit || int64(len(services)) >= res.GetCount() {
+			return services, nil
+		}
+	}
+}
+
+type idKind string
+
+const (
+	idKindApp     idKind = "app"
+	idKindDomain  idKind = "domain"
+	idKindSecret  idKind = "secret"
+	idKindService idKind = "service"
+)
+
+// ResolveID returns the ID of the resource of the given kind identified by
+// name, which can also be a short ID or an ID. Services are identified by
+// their "<app name>/<service name>" slug. Resolutions are cached for the
+// lifetime of the provider instance, so listing a collection to resolve a
+// name only happens once per name.
+func (c *Client) ResolveID(ctx context.Context, kind idKind, name string) (string, error) {
+	return c.ids.resolve(kind, name, func() (string, error) {
+		mapper := idmapper.NewMapper(ctx, c.APIClient)
+
+		switch kind {
+		case idKindApp:
+			return mapper.App().ResolveID(name)
+		case idKindDomain:
+			return mapper.Domain().ResolveID(name)
+		case idKindSecret:
+			return mapper.Secret().ResolveID(name)
+		case idKindService:
+			return mapper.Service().ResolveID(name)
+		}
+
+		return "", fmt.Errorf("unknown resource kind %q", kind)
+	})
+}
+
+// idCache is a concurrency-safe cache of name to ID resolutions. Concurrent
+// resolutions of the same name share a single lookup, and failed lookups are
+// not cached.
+type idCache struct {
+	mu       sync.Mutex
+	ids      map[string]string
+	inflight map[string]*idLookup
+}
+
+type idLookup struct {
+	done chan struct{}
+	id   string
+	err  error
+}
+
+func newIDCache() *idCache {
+	return &idCache{
+		ids:      map[string]string{},
+		inflight: map[string]*idLookup{},
+	}
+}
+
+func idCacheKey(kind idKind, name string) string {
+	return string(kind) + ":" + name
+}
+
+func (c *idCache) resolve(kind idKind, name string, lookup func() (string, error)) (string, error) {
+	key := idCacheKey(kind, name)
+
+	c.mu.Lock()
+	if id, ok := c.ids[key]; ok {
+		c.mu.Unlock()
+		return id, nil
+	}
+	if l, ok := c.inflight[key]; ok {
+		c.mu.Unlock()
+		<-l.done
+		return l.id, l.err
+	}
+	l := &idLookup{done: make(chan struct{})}
+	c.inflight[key] = l
+	c.mu.Unlock()
+
+	l.id, l.err = lookup()
+
+	c.mu.Lock()
+	delete(c.inflight, key)
+	if l.err == nil {
+		c.ids[key] = l.id
+	}
+	c.mu.Unlock()
+	close(l.done)
+
+	return l.id, l.err
+}
+
+// set records the ID of a resource that was just created.
+func (c *idCache) set(kind idKind, name string, id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.ids[idCacheKey(kind, name)] = id
+}
+
+// forget drops the resolutions of a resource that was deleted or renamed.
+// Forgetting an app also forgets the services it contained.
+func (c *idCache) forget(kind idKind, name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.ids, idCacheKey(kind, name))
+
+	if kind == idKindApp {
+		prefix := idCacheKey(idKindService, name+"/")
+		for key := range c.ids {
+			if strings.HasPrefix(key, prefix) {
+				delete(c.ids, key)
+			}
+		}
+	}
+}
+
+// secretUsageCache holds the slugs of the services using each secret, indexed
+// by secret name. The index is built on first use and dropped whenever a
+// service or an app changes, so refreshing every secret lists the services
+// once. Concurrent callers wait for the index being built.
+type secretUsageCache struct {
+	mu     sync.Mutex
+	usedBy map[string][]string
+}
+
+func (c *secretUsageCache) get(build func() (map[string][]string, error)) (map[string][]string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.usedBy != nil {
+		return c.usedBy, nil
+	}
+
+	usedBy, err := build()
+	if err != nil {
+		return nil, err
+	}
+	c.usedBy = usedBy
+
+	return usedBy, nil
+}
+
+// forget drops the index, it is built again on next use.
+func (c *secretUsageCache) forget() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.usedBy = nil
+}
@@ -0,0 +1,174 @@
+package koyeb
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"golang.org/x/exp/slices"
+)
+
+const testAppID = "4a6fe1c9-1f62-4ab4-92a2-3e8a1b6c9d01"
+
+func TestClient_ResolveIDIsCached(t *testing.T) {
+	var calls int32
+	client := testAPIClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/apps" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		atomic.AddInt32(&calls, 1)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"apps": [{"id": "` + testAppID + `", "name": "my-app"}], "count": 1}`))
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			id, err := client.ResolveID(context.Background(), idKindApp, "my-app")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if id != testAppID {
+				t.Errorf("expected %s, got %s", testAppID, id)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if calls != 1 {
+		t.Fatalf("expected apps to be listed once, got %d calls", calls)
+	}
+
+	client.ids.forget(idKindApp, "my-app")
+	if _, err := client.ResolveID(context.Background(), idKindApp, "my-app"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if calls != 2 {
+		t.Fatalf("expected apps to be listed again after invalidation, got %d calls", calls)
+	}
+}
+
+func TestIDCache_DoesNotCacheFailures(t *testing.T) {
+	cache := newIDCache()
+	calls := 0
+	lookup := func() (string, error) {
+		calls++
+		if calls == 1 {
+			return "", errors.New("not found")
+		}
+		return "id", nil
+	}
+
+	if _, err := cache.resolve(idKindSecret, "secret", lookup); err == nil {
+		t.Fatal("expected an error")
+	}
+	if id, err := cache.resolve(idKindSecret, "secret", lookup); err != nil || id != "id" {
+		t.Fatalf("expected the lookup to be retried, got %q, %v", id, err)
+	}
+}
+
+func TestIDCache_ForgetAppForgetsItsServices(t *testing.T) {
+	cache := newIDCache()
+	cache.set(idKindApp, "app", "app-id")
+	cache.set(idKindService, serviceSlug("app", "web"), "service-id")
+	cache.set(idKindService, serviceSlug("app-2", "web"), "other-service-id")
+
+	cache.forget(idKindApp, "app")
+
+	for key, expected := range map[string]bool{
+		idCacheKey(idKindApp, "app"):                           false,
+		idCacheKey(idKindService, serviceSlug("app", "web")):   false,
+		idCacheKey(idKindService, serviceSlug("app-2", "web")): true,
+	} {
+		if _, ok := cache.ids[key]; ok != expected {
+			t.Errorf("expected %s to be cached: %t", key, expected)
+		}
+	}
+}
+
+func TestClient_LoadAccount(t *testing.T) {
+	const organizationID = "0d6e8f2a-3c4b-4e5f-9a1b-2c3d4e5f6a7b"
+
+	client := testAPIClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		switch r.URL.Path {
+		case "/v1/account/profile":
+			w.Write([]byte(`{"user": {"id": "user-id", "email": "user@example.com", "default_organization_id": "` + organizationID + `"}}`))
+		case "/v1/organizations/" + organizationID:
+			w.Write([]byte(`{"organization": {"name": "my-organization"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+
+	if err := client.loadAccount(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if client.User.GetEmail() != "user@example.com" {
+		t.Errorf("unexpected user: %+v", client.User)
+	}
+	if client.OrganizationID != organizationID || client.Organization.GetName() != "my-organization" {
+		t.Errorf("unexpected organization %s: %+v", client.OrganizationID, client.Organization)
+	}
+}
+
+func TestSecretUsedBy_ListsServicesOnce(t *testing.T) {
+	var listCalls int32
+	client := testAPIClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		switch r.URL.Path {
+		case "/v1/services":
+			atomic.AddInt32(&listCalls, 1)
+			w.Write([]byte(`{"services": [
+				{"id": "service-1", "name": "web", "app_id": "` + testAppID + `", "status": "HEALTHY", "latest_deployment_id": "deployment-1"},
+				{"id": "service-2", "name": "worker", "app_id": "` + testAppID + `", "status": "HEALTHY", "latest_deployment_id": "deployment-2"}
+			], "count": 2}`))
+		case "/v1/deployments/deployment-1":
+			w.Write([]byte(`{"deployment": {"definition": {"env": [{"key": "TOKEN", "secret": "token"}], "docker": {"image": "koyeb/demo", "image_registry_secret": "registry"}}}}`))
+		case "/v1/deployments/deployment-2":
+			w.Write([]byte(`{"deployment": {"definition": {"env": [{"key": "TOKEN", "secret": "token"}, {"key": "OTHER", "secret": "token"}]}}}`))
+		case "/v1/apps/" + testAppID:
+			w.Write([]byte(`{"app": {"id": "` + testAppID + `", "name": "my-app"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+
+	for secret, expected := range map[string][]string{
+		"token":    {"my-app/web", "my-app/worker"},
+		"registry": {"my-app/web"},
+		"unused":   {},
+	} {
+		usedBy, err := secretUsedBy(context.Background(), client, secret)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if !slices.Equal(usedBy, expected) {
+			t.Errorf("expected %s to be used by %v, got %v", secret, expected, usedBy)
+		}
+	}
+
+	if listCalls != 1 {
+		t.Fatalf("expected services to be listed once, got %d calls", listCalls)
+	}
+
+	client.secretUsage.forget()
+	if _, err := secretUsedBy(context.Background(), client, "token"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if listCalls != 2 {
+		t.Fatalf("expected services to be listed again after invalidation, got %d calls", listCalls)
+	}
+}
@@ -5,24 +5,28 @@ import (
 
 	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
-	"github.com/koyeb/koyeb-api-client-go/api/v1/koyeb"
-	"github.com/koyeb/koyeb-cli/pkg/koyeb/idmapper"
 )
 
 func dataSourceKoyebApp() *schema.Resource {
 	return &schema.Resource{
 		ReadContext: dataSourceKoyebAppRead,
-		Schema:      appSchema(),
+		Schema:      dataSourceAppSchema(),
 	}
 }
 
-func dataSourceKoyebAppRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
-	client := meta.(*koyeb.APIClient)
+// dataSourceAppSchema is the app schema without the arguments that only
+// apply to the resource.
+func dataSourceAppSchema() map[string]*schema.Schema {
+	app := appSchema()
+	delete(app, "force_destroy")
+
+	return app
+}
 
-	mapper := idmapper.NewMapper(context.Background(), client)
-	appMapper := mapper.App()
+func dataSourceKoyebAppRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	client := meta.(*Client)
 
-	id, err := appMapper.ResolveID(d.Get("name").(string))
+	id, err := client.ResolveID(ctx, idKindApp, d.Get("name").(string))
 
 	if err != nil {
 		return diag.Errorf("Error retrieving app: %s", err)
@@ -10,6 +10,17 @@ import (
 	"github.com/koyeb/koyeb-api-client-go/api/v1/koyeb"
 )
 
+func TestDataSourceKoyebApp_Schema(t *testing.T) {
+	s := dataSourceKoyebApp().Schema
+
+	if _, ok := s["force_destroy"]; ok {
+		t.Errorf("expected the resource only attribute force_destroy to be left out of the data source")
+	}
+	if err := dataSourceKoyebApp().InternalValidate(nil, false); err != nil {
+		t.Errorf("expected a valid data source schema, got %s", err)
+	}
+}
+
 func TestAccDataSourceKoyebApp_Basic(t *testing.T) {
 	var app koyeb.App
 	appName := randomTestName()
@@ -26,8 +37,8 @@ data "koyeb_app" "bar" {
 }`
 
 	resource.ParallelTest(t, resource.TestCase{
-		PreCheck:          func() { testAccPreCheck(t) },
-		ProviderFactories: testAccProviderFactories,
+		PreCheck:                 func() { testAccPreCheck(t) },
+		ProtoV5ProviderFactories: testAccProtoV5ProviderFactories,
 		Steps: []resource.TestStep{
 			{
 				Config: resourceConfig,
@@ -83,7 +94,7 @@ func testAccCheckDataSourceKoyebAppExists(n string, app *koyeb.App) resource.Tes
 			return fmt.Errorf("No Record ID is set")
 		}
 
-		client := testAccProvider.Meta().(*koyeb.APIClient)
+		client := testAccProvider.Meta().(*Client)
 
 		res, _, err := client.AppsApi.GetApp(context.Background(), rs.Primary.ID).Execute()
 
@@ -5,24 +5,28 @@ import (
 
 	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
-	"github.com/koyeb/koyeb-api-client-go/api/v1/koyeb"
-	"github.com/koyeb/koyeb-cli/pkg/koyeb/idmapper"
 )
 
 func dataSourceKoyebDomain() *schema.Resource {
 	return &schema.Resource{
 		ReadContext: dataSourceKoyebDomainRead,
-		Schema:      domainSchema(),
+		Schema:      dataSourceDomainSchema(),
 	}
 }
 
-func dataSourceKoyebDomainRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
-	client := meta.(*koyeb.APIClient)
+// dataSourceDomainSchema is the computed domain schema, looked up by name.
+func dataSourceDomainSchema() map[string]*schema.Schema {
+	domain := computedDomainSchema()
+	domain["name"].Computed = false
+	domain["name"].Required = true
+
+	return domain
+}
 
-	mapper := idmapper.NewMapper(context.Background(), client)
-	domainMapper := mapper.Domain()
+func dataSourceKoyebDomainRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	client := meta.(*Client)
 
-	id, err := domainMapper.ResolveID(d.Get("name").(string))
+	id, err := client.ResolveID(ctx, idKindDomain, d.Get("name").(string))
 
 	if err != nil {
 		return diag.Errorf("Error retrieving domain: %s", err)
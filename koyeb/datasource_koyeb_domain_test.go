@@ -6,10 +6,36 @@ import (
 	"testing"
 
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
 	"github.com/koyeb/koyeb-api-client-go/api/v1/koyeb"
 )
 
+func TestDataSourceKoyebDomain_Schema(t *testing.T) {
+	domains := resourceKoyebApp().Schema["domains"].Elem.(*schema.Resource).Schema
+
+	for name, s := range map[string]map[string]*schema.Schema{
+		"data source": dataSourceKoyebDomain().Schema,
+		"app domains": domains,
+	} {
+		if _, ok := s["wait_for_verification"]; ok {
+			t.Errorf("expected wait_for_verification to be left out of the %s", name)
+		}
+		for attribute, attributeSchema := range s {
+			if attributeSchema.Optional {
+				t.Errorf("expected %s of the %s to be read only", attribute, name)
+			}
+		}
+	}
+
+	if !dataSourceKoyebDomain().Schema["name"].Required {
+		t.Errorf("expected the data source to look up the domain by name")
+	}
+	if err := dataSourceKoyebDomain().InternalValidate(nil, false); err != nil {
+		t.Errorf("expected a valid data source schema, got %s", err)
+	}
+}
+
 func TestAccDataSourceKoyebDomain_Basic(t *testing.T) {
 	var domain koyeb.Domain
 	domainName := randomTestName() + ".com"
@@ -26,8 +52,8 @@ data "koyeb_domain" "bar" {
 }`
 
 	resource.ParallelTest(t, resource.TestCase{
-		PreCheck:          func() { testAccPreCheck(t) },
-		ProviderFactories: testAccProviderFactories,
+		PreCheck:                 func() { testAccPreCheck(t) },
+		ProtoV5ProviderFactories: testAccProtoV5ProviderFactories,
 		Steps: []resource.TestStep{
 			{
 				Config: resourceConfig,
@@ -46,7 +72,7 @@ data "koyeb_domain" "bar" {
 					resource.TestCheckResourceAttrSet("data.koyeb_domain.bar", "status"),
 					resource.TestCheckResourceAttrSet("data.koyeb_domain.bar", "messages"),
 					resource.TestCheckResourceAttrSet("data.koyeb_domain.bar", "version"),
-					resource.TestCheckResourceAttrSet("data.koyeb_domain.bar", "verified_at"),
+					resource.TestCheckNoResourceAttr("data.koyeb_domain.bar", "verified_at"),
 					resource.TestCheckResourceAttrSet("data.koyeb_domain.bar", "updated_at"),
 					resource.TestCheckResourceAttrSet("data.koyeb_domain.bar", "created_at"),
 				),
@@ -78,7 +104,7 @@ func testAccCheckDataSourceKoyebDomainExists(n string, domain *koyeb.Domain) res
 			return fmt.Errorf("No Record ID is set")
 		}
 
-		client := testAccProvider.Meta().(*koyeb.APIClient)
+		client := testAccProvider.Meta().(*Client)
 
 		res, _, err := client.DomainsApi.GetDomain(context.Background(), rs.Primary.ID).Execute()
 
@@ -5,30 +5,47 @@ import (
 
 	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
-	"github.com/koyeb/koyeb-api-client-go/api/v1/koyeb"
-	"github.com/koyeb/koyeb-cli/pkg/koyeb/idmapper"
 )
 
 func dataSourceKoyebSecret() *schema.Resource {
 	return &schema.Resource{
 		ReadContext: dataSourceKoyebSecretRead,
-		Schema:      secretSchema(),
+		Schema:      dataSourceSecretSchema(),
 	}
 }
 
-func dataSourceKoyebSecretRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
-	client := meta.(*koyeb.APIClient)
+// dataSourceSecretSchema is the secret schema without the arguments that
+// only apply to the resource.
+func dataSourceSecretSchema() map[string]*schema.Schema {
+	secret := secretSchema()
+	for _, name := range []string{"generate", "rotation_trigger", "keeper_hash", "prevent_destroy_if_used"} {
+		delete(secret, name)
+	}
+
+	return secret
+}
 
-	mapper := idmapper.NewMapper(context.Background(), client)
-	SecretMapper := mapper.Secret()
+func dataSourceKoyebSecretRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	client := meta.(*Client)
 
-	id, err := SecretMapper.ResolveID(d.Get("name").(string))
+	id, err := client.ResolveID(ctx, idKindSecret, d.Get("name").(string))
 
 	if err != nil {
 		return diag.Errorf("Error retrieving secret: %s", err)
 	}
 
-	d.SetId(id)
+	res, _, err := client.SecretsApi.GetSecret(ctx, id).Execute()
+	if err != nil {
+		return apiErrorDiagnostics("Error retrieving secret", err, dataSourceSecretSchema())
+	}
+
+	setSecretAttribute(d, *res.Secret)
+
+	usedBy, err := secretUsedBy(ctx, client, res.Secret.GetName())
+	if err != nil {
+		return diag.Errorf("Error retrieving services using secret: %s", err)
+	}
+	d.Set("used_by", usedBy)
 
-	return resourceKoyebSecretRead(ctx, d, meta)
+	return nil
 }
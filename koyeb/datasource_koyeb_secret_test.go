@@ -10,6 +10,19 @@ import (
 	"github.com/koyeb/koyeb-api-client-go/api/v1/koyeb"
 )
 
+func TestDataSourceKoyebSecret_Schema(t *testing.T) {
+	s := dataSourceKoyebSecret().Schema
+
+	for _, name := range []string{"generate", "rotation_trigger", "keeper_hash", "prevent_destroy_if_used"} {
+		if _, ok := s[name]; ok {
+			t.Errorf("expected the resource only attribute %s to be left out of the data source", name)
+		}
+	}
+	if _, ok := s["used_by"]; !ok {
+		t.Errorf("expected used_by in the data source")
+	}
+}
+
 func TestAccDataSourceKoyebSecret_Basic(t *testing.T) {
 	var secret koyeb.Secret
 	secretName := randomTestName()
@@ -27,8 +40,8 @@ data "koyeb_secret" "bar" {
 }`
 
 	resource.ParallelTest(t, resource.TestCase{
-		PreCheck:          func() { testAccPreCheck(t) },
-		ProviderFactories: testAccProviderFactories,
+		PreCheck:                 func() { testAccPreCheck(t) },
+		ProtoV5ProviderFactories: testAccProtoV5ProviderFactories,
 		Steps: []resource.TestStep{
 			{
 				Config: resourceConfig,
@@ -72,7 +85,7 @@ func testAccCheckDataSourceKoyebSecretExists(n string, secret *koyeb.Secret) res
 			return fmt.Errorf("No Record ID is set")
 		}
 
-		client := testAccProvider.Meta().(*koyeb.APIClient)
+		client := testAccProvider.Meta().(*Client)
 
 		res, _, err := client.SecretsApi.GetSecret(context.Background(), rs.Primary.ID).Execute()
 
@@ -5,8 +5,6 @@ import (
 
 	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
-	"github.com/koyeb/koyeb-api-client-go/api/v1/koyeb"
-	"github.com/koyeb/koyeb-cli/pkg/koyeb/idmapper"
 )
 
 func dataSourceKoyebService() *schema.Resource {
@@ -97,12 +95,9 @@ func dataSourceKoyebService() *schema.Resource {
 }
 
 func dataSourceKoyebServiceRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
-	client := meta.(*koyeb.APIClient)
+	client := meta.(*Client)
 
-	mapper := idmapper.NewMapper(context.Background(), client)
-	serviceMapper := mapper.Service()
-
-	id, err := serviceMapper.ResolveID(d.Get("slug").(string))
+	id, err := client.ResolveID(ctx, idKindService, d.Get("slug").(string))
 
 	if err != nil {
 		return diag.Errorf("Error retrieving service: %s", err)
@@ -59,8 +59,8 @@ data "koyeb_service" "foobar" {
 }`
 
 	resource.ParallelTest(t, resource.TestCase{
-		PreCheck:          func() { testAccPreCheck(t) },
-		ProviderFactories: testAccProviderFactories,
+		PreCheck:                 func() { testAccPreCheck(t) },
+		ProtoV5ProviderFactories: testAccProtoV5ProviderFactories,
 		Steps: []resource.TestStep{
 			{
 				Config: resourceConfig,
@@ -78,9 +78,9 @@ data "koyeb_service" "foobar" {
 					resource.TestCheckResourceAttrSet("data.koyeb_service.foobar", "version"),
 					resource.TestCheckResourceAttrSet("data.koyeb_service.foobar", "status"),
 					resource.TestCheckResourceAttrSet("data.koyeb_service.foobar", "messages"),
-					resource.TestCheckResourceAttrSet("data.koyeb_service.foobar", "paused_at"),
-					resource.TestCheckResourceAttrSet("data.koyeb_service.foobar", "resumed_at"),
-					resource.TestCheckResourceAttrSet("data.koyeb_service.foobar", "terminated_at"),
+					resource.TestCheckNoResourceAttr("data.koyeb_service.foobar", "paused_at"),
+					resource.TestCheckNoResourceAttr("data.koyeb_service.foobar", "resumed_at"),
+					resource.TestCheckNoResourceAttr("data.koyeb_service.foobar", "terminated_at"),
 					resource.TestCheckResourceAttrSet("data.koyeb_service.foobar", "latest_deployment"),
 				),
 			},
@@ -100,7 +100,7 @@ func testAccCheckDataSourceKoyebServiceExists(n string, service *koyeb.Service)
 			return fmt.Errorf("No Record ID is set")
 		}
 
-		client := testAccProvider.Meta().(*koyeb.APIClient)
+		client := testAccProvider.Meta().(*Client)
 
 		res, _, err := client.ServicesApi.GetService(context.Background(), rs.Primary.ID).Execute()
 
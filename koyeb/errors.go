@@ -0,0 +1,115 @@
+package koyeb
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/go-cty/cty"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/koyeb/koyeb-api-client-go/api/v1/koyeb"
+)
+
+var apiFieldIndexRegexp = regexp.MustCompile(`\[(\d+)\]`)
+
+// parseAPIError extracts the error returned by the Koyeb API from the body of
+// err. It returns false when err is not an API error or its body can't be parsed.
+func parseAPIError(err error) (koyeb.ErrorWithFields, bool) {
+	var apiErr koyeb.GenericOpenAPIError
+	if !errors.As(err, &apiErr) {
+		return koyeb.ErrorWithFields{}, false
+	}
+
+	var body koyeb.ErrorWithFields
+	if jsonErr := json.Unmarshal(apiErr.Body(), &body); jsonErr != nil || body.GetMessage() == "" {
+		return koyeb.ErrorWithFields{}, false
+	}
+
+	return body, true
+}
+
+// apiErrorDiagnostics turns an API error into diagnostics. The message sent by
+// the API is used as the summary and each field validation error gets its own
+// diagnostic, pointing at the matching attribute of resourceSchema when found.
+func apiErrorDiagnostics(summary string, err error, resourceSchema map[string]*schema.Schema) diag.Diagnostics {
+	body, ok := parseAPIError(err)
+	if !ok {
+		return diag.Errorf("%s: %s", summary, err)
+	}
+
+	detail := fmt.Sprintf("The Koyeb API returned status %d", body.GetStatus())
+	if body.GetCode() != "" {
+		detail = fmt.Sprintf("%s with code %s", detail, body.GetCode())
+	}
+
+	diags := diag.Diagnostics{{
+		Severity: diag.Error,
+		Summary:  fmt.Sprintf("%s: %s", summary, body.GetMessage()),
+		Detail:   detail,
+	}}
+
+	for _, field := range body.GetFields() {
+		diags = append(diags, diag.Diagnostic{
+			Severity:      diag.Error,
+			Summary:       fmt.Sprintf("%s: invalid %s", summary, field.GetField()),
+			Detail:        field.GetDescription(),
+			AttributePath: apiFieldPath(field.GetField(), resourceSchema),
+		})
+	}
+
+	return diags
+}
+
+// apiFieldPath converts a field reported by the API, such as
+// "definition.ports[0].port" or "definition.ports.0.port", to the path of the
+// matching attribute in resourceSchema. The path stops at the deepest attribute
+// that can be addressed, e.g. at a set since its elements have no index.
+func apiFieldPath(field string, resourceSchema map[string]*schema.Schema) cty.Path {
+	segments := strings.Split(apiFieldIndexRegexp.ReplaceAllString(field, ".$1"), ".")
+	path := cty.Path{}
+
+	for i := 0; i < len(segments); i++ {
+		s, ok := resourceSchema[segments[i]]
+		if !ok {
+			break
+		}
+		path = path.GetAttr(segments[i])
+
+		switch s.Type {
+		case schema.TypeList:
+			if i+1 < len(segments) {
+				if index, err := strconv.Atoi(segments[i+1]); err == nil {
+					path = path.IndexInt(index)
+					i++
+				} else if s.MaxItems == 1 {
+					path = path.IndexInt(0)
+				} else {
+					return path
+				}
+			}
+		case schema.TypeMap:
+			if i+1 < len(segments) {
+				path = path.IndexString(segments[i+1])
+			}
+			return path
+		default:
+			return path
+		}
+
+		elem, ok := s.Elem.(*schema.Resource)
+		if !ok {
+			return path
+		}
+		resourceSchema = elem.Schema
+	}
+
+	if len(path) == 0 {
+		return nil
+	}
+
+	return path
+}
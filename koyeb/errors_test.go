@@ -0,0 +1,126 @@
+package koyeb
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/hashicorp/go-cty/cty"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/koyeb/koyeb-api-client-go/api/v1/koyeb"
+)
+
+// testAPIError returns the error the API client produces when the API answers
+// with the given status code and body.
+func testAPIError(t *testing.T, statusCode int, body string) error {
+	client := testAPIClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(statusCode)
+		w.Write([]byte(body))
+	})
+
+	_, _, err := client.ServicesApi.CreateService(context.Background()).Body(koyeb.CreateService{}).Execute()
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+
+	return err
+}
+
+func TestAPIErrorDiagnostics_FieldErrors(t *testing.T) {
+	err := testAPIError(t, 400, `{
+		"status": 400,
+		"code": "invalid_argument",
+		"message": "Validation error",
+		"fields": [
+			{"field": "definition.ports[0].port", "description": "must be between 1 and 65535"},
+			{"field": "name", "description": "must be unique"}
+		]
+	}`)
+
+	diags := apiErrorDiagnostics("Error creating service", err, serviceSchema())
+	if len(diags) != 3 {
+		t.Fatalf("expected 3 diagnostics, got %d: %v", len(diags), diags)
+	}
+
+	if diags[0].Summary != "Error creating service: Validation error" {
+		t.Errorf("unexpected summary: %q", diags[0].Summary)
+	}
+	if diags[0].Detail != "The Koyeb API returned status 400 with code invalid_argument" {
+		t.Errorf("unexpected detail: %q", diags[0].Detail)
+	}
+	if diags[1].Detail != "must be between 1 and 65535" || len(diags[1].AttributePath) == 0 {
+		t.Errorf("unexpected field diagnostic: %+v", diags[1])
+	}
+	if !diags[2].AttributePath.Equals(cty.GetAttrPath("name")) {
+		t.Errorf("unexpected attribute path: %#v", diags[2].AttributePath)
+	}
+}
+
+func TestAPIErrorDiagnostics_NotAnAPIError(t *testing.T) {
+	diags := apiErrorDiagnostics("Error deleting app", errors.New("connection refused"), nil)
+	if len(diags) != 1 || diags[0].Summary != "Error deleting app: connection refused" {
+		t.Fatalf("unexpected diagnostics: %v", diags)
+	}
+
+	err := testAPIError(t, 502, "<html>Bad Gateway</html>")
+	diags = apiErrorDiagnostics("Error deleting app", err, nil)
+	if len(diags) != 1 || diags[0].Summary != "Error deleting app: "+err.Error() {
+		t.Fatalf("unexpected diagnostics: %v", diags)
+	}
+}
+
+func TestAPIFieldPath(t *testing.T) {
+	resourceSchema := map[string]*schema.Schema{
+		"name": {Type: schema.TypeString},
+		"labels": {
+			Type: schema.TypeMap,
+			Elem: &schema.Schema{Type: schema.TypeString},
+		},
+		"definition": {
+			Type:     schema.TypeList,
+			MaxItems: 1,
+			Elem: &schema.Resource{
+				Schema: map[string]*schema.Schema{
+					"ports": {
+						Type: schema.TypeList,
+						Elem: &schema.Resource{
+							Schema: map[string]*schema.Schema{
+								"port": {Type: schema.TypeInt},
+							},
+						},
+					},
+					"env": {
+						Type: schema.TypeSet,
+						Elem: &schema.Resource{
+							Schema: map[string]*schema.Schema{
+								"key": {Type: schema.TypeString},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	cases := []struct {
+		field    string
+		expected cty.Path
+	}{
+		{"name", cty.GetAttrPath("name")},
+		{"labels.env", cty.GetAttrPath("labels").IndexString("env")},
+		{"definition.ports", cty.GetAttrPath("definition").IndexInt(0).GetAttr("ports")},
+		{"definition.ports[1].port", cty.GetAttrPath("definition").IndexInt(0).GetAttr("ports").IndexInt(1).GetAttr("port")},
+		{"definition.ports.1.port", cty.GetAttrPath("definition").IndexInt(0).GetAttr("ports").IndexInt(1).GetAttr("port")},
+		{"definition.env[0].key", cty.GetAttrPath("definition").IndexInt(0).GetAttr("env")},
+		{"definition.unknown", cty.GetAttrPath("definition").IndexInt(0)},
+		{"unknown", nil},
+	}
+
+	for _, c := range cases {
+		if got := apiFieldPath(c.field, resourceSchema); !got.Equals(c.expected) {
+			t.Errorf("apiFieldPath(%q) = %#v, expected %#v", c.field, got, c.expected)
+		}
+	}
+}
@@ -0,0 +1,978 @@
+package koyeb
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/koyeb/koyeb-api-client-go/api/v1/koyeb"
+)
+
+// fakeAPIURL is the value of KOYEB_API_URL running the acceptance tests
+// against an in-process fake of the Koyeb API instead of the real one.
+const fakeAPIURL = "fake"
+
+// fakeAPIToken is the token used with the fake API when KOYEB_TOKEN is unset.
+const fakeAPIToken = "fake-token"
+
+// fakeAPI is an in-memory implementation of the parts of the Koyeb API used by
+// the provider. Services and domains go through the status transitions of the
+// real API, advancing by one step every time they are read, so the waiters
+// poll them the way they poll the real API.
+type fakeAPI struct {
+	mu  sync.Mutex
+	mux *http.ServeMux
+
+	user         koyeb.User
+	organization koyeb.Organization
+
+	apps        map[string]*koyeb.App
+	services    map[string]*koyeb.Service
+	deployments map[string]*koyeb.Deployment
+	domains     map[string]*koyeb.Domain
+	secrets     map[string]*koyeb.Secret
+
+	// resolvable are the names of the custom domains whose CNAME record is
+	// configured, which get verified
+	resolvable map[string]bool
+}
+
+func newFakeAPI() *fakeAPI {
+	f := &fakeAPI{
+		mux:          http.NewServeMux(),
+		user:         koyeb.User{Id: toOpt(fakeID()), Email: toOpt("fake@koyeb.com"), DefaultOrganizationId: toOpt(fakeID())},
+		organization: koyeb.Organization{Name: toOpt("fake-organization")},
+		apps:         map[string]*koyeb.App{},
+		services:     map[string]*koyeb.Service{},
+		deployments:  map[string]*koyeb.Deployment{},
+		domains:      map[string]*koyeb.Domain{},
+		secrets:      map[string]*koyeb.Secret{},
+		resolvable:   map[string]bool{},
+	}
+
+	f.mux.HandleFunc("GET /v1/account/profile", f.getProfile)
+	f.mux.HandleFunc("GET /v1/organizations/{id}", f.getOrganization)
+
+	f.mux.HandleFunc("POST /v1/apps", f.createApp)
+	f.mux.HandleFunc("GET /v1/apps", f.listApps)
+	f.mux.HandleFunc("GET /v1/apps/{id}", f.getApp)
+	f.mux.HandleFunc("PUT /v1/apps/{id}", f.updateApp)
+	f.mux.HandleFunc("PATCH /v1/apps/{id}", f.updateApp)
+	f.mux.HandleFunc("DELETE /v1/apps/{id}", f.deleteApp)
+
+	f.mux.HandleFunc("POST /v1/services", f.createService)
+	f.mux.HandleFunc("GET /v1/services", f.listServices)
+	f.mux.HandleFunc("GET /v1/services/{id}", f.getService)
+	f.mux.HandleFunc("PUT /v1/services/{id}", f.updateService)
+	f.mux.HandleFunc("PATCH /v1/services/{id}", f.updateService)
+	f.mux.HandleFunc("DELETE /v1/services/{id}", f.deleteService)
+
+	f.mux.HandleFunc("GET /v1/deployments", f.listDeployments)
+	f.mux.HandleFunc("GET /v1/deployments/{id}", f.getDeployment)
+
+	f.mux.HandleFunc("POST /v1/domains", f.createDomain)
+	f.mux.HandleFunc("GET /v1/domains", f.listDomains)
+	f.mux.HandleFunc("GET /v1/domains/{id}", f.getDomain)
+	f.mux.HandleFunc("PATCH /v1/domains/{id}", f.updateDomain)
+	f.mux.HandleFunc("DELETE /v1/domains/{id}", f.deleteDomain)
+
+	f.mux.HandleFunc("POST /v1/secrets", f.createSecret)
+	f.mux.HandleFunc("GET /v1/secrets", f.listSecrets)
+	f.mux.HandleFunc("GET /v1/secrets/{id}", f.getSecret)
+	f.mux.HandleFunc("PUT /v1/secrets/{id}", f.updateSecret)
+	f.mux.HandleFunc("PATCH /v1/secrets/{id}", f.updateSecret)
+	f.mux.HandleFunc("DELETE /v1/secrets/{id}", f.deleteSecret)
+
+	return f
+}
+
+// resolve marks the custom domain name as having its CNAME record configured.
+func (f *fakeAPI) resolve(name string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.resolvable[name] = true
+}
+
+func (f *fakeAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") {
+		fakeError(w, http.StatusUnauthorized, "unauthenticated", "Invalid credentials")
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.mux.ServeHTTP(w, r)
+}
+
+func (f *fakeAPI) getProfile(w http.ResponseWriter, r *http.Request) {
+	fakeReply(w, koyeb.UserReply{User: &f.user})
+}
+
+func (f *fakeAPI) getOrganization(w http.ResponseWriter, r *http.Request) {
+	if r.PathValue("id") != f.user.GetDefaultOrganizationId() {
+		fakeNotFound(w, "organization")
+		return
+	}
+
+	fakeReply(w, koyeb.GetOrganizationReply{Organization: &f.organization})
+}
+
+func (f *fakeAPI) createApp(w http.ResponseWriter, r *http.Request) {
+	var body koyeb.CreateApp
+	if !fakeDecode(w, r, &body) {
+		return
+	}
+
+	if !f.validAppName(w, body.GetName(), "") {
+		return
+	}
+
+	now := time.Now().UTC()
+	app := &koyeb.App{
+		Id:             toOpt(fakeID()),
+		Name:           toOpt(body.GetName()),
+		OrganizationId: f.user.DefaultOrganizationId,
+		CreatedAt:      &now,
+		UpdatedAt:      &now,
+	}
+	f.apps[app.GetId()] = app
+
+	// Every app gets a Koyeb-provided subdomain
+	f.addDomain(fmt.Sprintf("%s-%s.koyeb.app", app.GetName(), f.organization.GetName()), koyeb.DOMAINTYPE_AUTOASSIGNED, app.GetId())
+
+	fakeReply(w, koyeb.CreateAppReply{App: f.app(app)})
+}
+
+func (f *fakeAPI) listApps(w http.ResponseWriter, r *http.Request) {
+	apps := []koyeb.AppListItem{}
+	for _, app := range fakeSorted(f.apps) {
+		if name := r.URL.Query().Get("name"); name != "" && app.GetName() != name {
+			continue
+		}
+
+		app = f.app(app)
+		apps = append(apps, koyeb.AppListItem{
+			Id:             app.Id,
+			Name:           app.Name,
+			OrganizationId: app.OrganizationId,
+			CreatedAt:      app.CreatedAt,
+			UpdatedAt:      app.UpdatedAt,
+			Domains:        app.Domains,
+		})
+	}
+
+	apps, limit, offset, count := fakePage(r, apps)
+	fakeReply(w, koyeb.ListAppsReply{Apps: &apps, Limit: &limit, Offset: &offset, Count: &count})
+}
+
+func (f *fakeAPI) getApp(w http.ResponseWriter, r *http.Request) {
+	app, ok := f.apps[r.PathValue("id")]
+	if !ok {
+		fakeNotFound(w, "app")
+		return
+	}
+
+	fakeReply(w, koyeb.GetAppReply{App: f.app(app)})
+}
+
+func (f *fakeAPI) updateApp(w http.ResponseWriter, r *http.Request) {
+	app, ok := f.apps[r.PathValue("id")]
+	if !ok {
+		fakeNotFound(w, "app")
+		return
+	}
+
+	var body koyeb.UpdateApp
+	if !fakeDecode(w, r, &body) {
+		return
+	}
+
+	if name, ok := body.GetNameOk(); ok {
+		if !f.validAppName(w, *name, app.GetId()) {
+			return
+		}
+		app.Name = toOpt(*name)
+	}
+
+	now := time.Now().UTC()
+	app.UpdatedAt = &now
+
+	fakeReply(w, koyeb.UpdateAppReply{App: f.app(app)})
+}
+
+// deleteApp deletes the app along with its services and its Koyeb-provided
+// subdomain. Its custom domains are detached.
+func (f *fakeAPI) deleteApp(w http.ResponseWriter, r *http.Request) {
+	app, ok := f.apps[r.PathValue("id")]
+	if !ok {
+		fakeNotFound(w, "app")
+		return
+	}
+
+	for _, service := range f.services {
+		if service.GetAppId() == app.GetId() && service.GetStatus() != koyeb.SERVICESTATUS_DELETED {
+			service.Status = toOpt(koyeb.SERVICESTATUS_DELETING)
+		}
+	}
+
+	for id, domain := range f.domains {
+		if domain.GetAppId() != app.GetId() {
+			continue
+		}
+
+		if domain.GetType() == koyeb.DOMAINTYPE_AUTOASSIGNED {
+			delete(f.domains, id)
+		} else {
+			domain.AppId = toOpt("")
+		}
+	}
+
+	delete(f.apps, app.GetId())
+
+	fakeReply(w, map[string]interface{}{})
+}
+
+func (f *fakeAPI) validAppName(w http.ResponseWriter, name string, id string) bool {
+	if name == "" {
+		fakeFieldError(w, "name", "must not be empty")
+		return false
+	}
+
+	for _, app := range f.apps {
+		if app.GetName() == name && app.GetId() != id {
+			fakeFieldError(w, "name", "already exists")
+			return false
+		}
+	}
+
+	return true
+}
+
+// app returns app with its domains, which are read along with it.
+func (f *fakeAPI) app(app *koyeb.App) *koyeb.App {
+	domains := []koyeb.Domain{}
+	for _, domain := range fakeSorted(f.domains) {
+		if domain.GetAppId() == app.GetId() {
+			domains = append(domains, *f.advanceDomain(domain))
+		}
+	}
+
+	result := *app
+	result.Domains = &domains
+
+	return &result
+}
+
+func (f *fakeAPI) createService(w http.ResponseWriter, r *http.Request) {
+	var body koyeb.CreateService
+	if !fakeDecode(w, r, &body) {
+		return
+	}
+
+	if _, ok := f.apps[body.GetAppId()]; !ok {
+		fakeFieldError(w, "app_id", "app not found")
+		return
+	}
+
+	definition := body.GetDefinition()
+	if definition.GetName() == "" {
+		fakeFieldError(w, "definition.name", "must not be empty")
+		return
+	}
+
+	for _, service := range f.services {
+		if service.GetAppId() == body.GetAppId() && service.GetName() == definition.GetName() && !fakeServiceDeleted(service) {
+			fakeFieldError(w, "definition.name", "already exists")
+			return
+		}
+	}
+
+	now := time.Now().UTC()
+	service := &koyeb.Service{
+		Id:             toOpt(fakeID()),
+		Name:           definition.Name,
+		AppId:          body.AppId,
+		OrganizationId: f.user.DefaultOrganizationId,
+		Version:        toOpt("0"),
+		CreatedAt:      &now,
+	}
+	f.services[service.GetId()] = service
+	f.deploy(service, definition)
+
+	fakeReply(w, koyeb.CreateServiceReply{Service: service})
+}
+
+func (f *fakeAPI) listServices(w http.ResponseWriter, r *http.Request) {
+	services := []koyeb.ServiceListItem{}
+	for _, service := range fakeSorted(f.services) {
+		if appId := r.URL.Query().Get("app_id"); appId != "" && service.GetAppId() != appId {
+			continue
+		}
+		if name := r.URL.Query().Get("name"); name != "" && service.GetName() != name {
+			continue
+		}
+
+		service = f.advanceService(service)
+		if service == nil {
+			continue
+		}
+
+		services = append(services, koyeb.ServiceListItem{
+			Id:                 service.Id,
+			Name:               service.Name,
+			OrganizationId:     service.OrganizationId,
+			AppId:              service.AppId,
+			CreatedAt:          service.CreatedAt,
+			UpdatedAt:          service.UpdatedAt,
+			Status:             service.Status,
+			Messages:           service.Messages,
+			Version:            service.Version,
+			ActiveDeploymentId: service.ActiveDeploymentId,
+			LatestDeploymentId: service.LatestDeploymentId,
+		})
+	}
+
+	services, limit, offset, count := fakePage(r, services)
+	fakeReply(w, koyeb.ListServicesReply{Services: &services, Limit: &limit, Offset: &offset, Count: &count})
+}
+
+func (f *fakeAPI) getService(w http.ResponseWriter, r *http.Request) {
+	service, ok := f.services[r.PathValue("id")]
+	if ok {
+		service = f.advanceService(service)
+	}
+	if service == nil {
+		fakeNotFound(w, "service")
+		return
+	}
+
+	fakeReply(w, koyeb.GetServiceReply{Service: service})
+}
+
+func (f *fakeAPI) updateService(w http.ResponseWriter, r *http.Request) {
+	service, ok := f.services[r.PathValue("id")]
+	if !ok || fakeServiceDeleted(service) {
+		fakeNotFound(w, "service")
+		return
+	}
+
+	var body koyeb.UpdateService
+	if !fakeDecode(w, r, &body) {
+		return
+	}
+
+	definition := body.GetDefinition()
+	if definition.GetName() != service.GetName() {
+		fakeFieldError(w, "definition.name", "cannot be changed")
+		return
+	}
+
+	f.deploy(service, definition)
+
+	fakeReply(w, koyeb.UpdateServiceReply{Service: service})
+}
+
+func (f *fakeAPI) deleteService(w http.ResponseWriter, r *http.Request) {
+	service, ok := f.services[r.PathValue("id")]
+	if !ok || fakeServiceDeleted(service) {
+		fakeNotFound(w, "service")
+		return
+	}
+
+	now := time.Now().UTC()
+	service.Status = toOpt(koyeb.SERVICESTATUS_DELETING)
+	service.Messages = &[]string{"Service is being deleted"}
+	service.UpdatedAt = &now
+
+	fakeReply(w, map[string]interface{}{})
+}
+
+// deploy creates a new deployment of the service with definition, which the
+// service starts.
+func (f *fakeAPI) deploy(service *koyeb.Service, definition koyeb.DeploymentDefinition) {
+	version, _ := strconv.Atoi(service.GetVersion())
+	now := time.Now().UTC()
+
+	deployment := &koyeb.Deployment{
+		Id:              toOpt(fakeID()),
+		OrganizationId:  service.OrganizationId,
+		AppId:           service.AppId,
+		ServiceId:       service.Id,
+		ParentId:        service.LatestDeploymentId,
+		Status:          toOpt(koyeb.DEPLOYMENTSTATUS_STARTING),
+		Definition:      &definition,
+		Messages:        &[]string{"Deployment is starting"},
+		Version:         toOpt(strconv.Itoa(version + 1)),
+		DeploymentGroup: toOpt("prod"),
+		CreatedAt:       &now,
+		UpdatedAt:       &now,
+	}
+	f.deployments[deployment.GetId()] = deployment
+
+	service.Status = toOpt(koyeb.SERVICESTATUS_STARTING)
+	service.Messages = &[]string{"Service is starting"}
+	service.Version = deployment.Version
+	service.LatestDeploymentId = deployment.Id
+	service.UpdatedAt = &now
+}
+
+// advanceService moves the service to its next status: a starting service
+// becomes healthy and a service being deleted is deleted. A deleted service
+// is read once and then removed, advancing it returns nil.
+func (f *fakeAPI) advanceService(service *koyeb.Service) *koyeb.Service {
+	now := time.Now().UTC()
+
+	switch service.GetStatus() {
+	case koyeb.SERVICESTATUS_STARTING:
+		if active, ok := f.deployments[service.GetActiveDeploymentId()]; ok {
+			active.Status = toOpt(koyeb.DEPLOYMENTSTATUS_STOPPED)
+			active.TerminatedAt = &now
+		}
+
+		latest := f.deployments[service.GetLatestDeploymentId()]
+		latest.Status = toOpt(koyeb.DEPLOYMENTSTATUS_HEALTHY)
+		latest.Messages = &[]string{"Deployment is healthy"}
+		latest.StartedAt = &now
+		latest.SucceededAt = &now
+
+		service.Status = toOpt(koyeb.SERVICESTATUS_HEALTHY)
+		service.Messages = &[]string{"Service is healthy"}
+		service.ActiveDeploymentId = service.LatestDeploymentId
+		service.UpdatedAt = &now
+	case koyeb.SERVICESTATUS_DELETING:
+		for _, deployment := range f.deployments {
+			if deployment.GetServiceId() == service.GetId() && deployment.GetStatus() != koyeb.DEPLOYMENTSTATUS_STOPPED {
+				deployment.Status = toOpt(koyeb.DEPLOYMENTSTATUS_STOPPED)
+				deployment.TerminatedAt = &now
+			}
+		}
+
+		service.Status = toOpt(koyeb.SERVICESTATUS_DELETED)
+		service.Messages = &[]string{"Service is deleted"}
+		service.TerminatedAt = &now
+		service.UpdatedAt = &now
+	case koyeb.SERVICESTATUS_DELETED:
+		delete(f.services, service.GetId())
+		for id, deployment := range f.deployments {
+			if deployment.GetServiceId() == service.GetId() {
+				delete(f.deployments, id)
+			}
+		}
+
+		return nil
+	}
+
+	return service
+}
+
+func fakeServiceDeleted(service *koyeb.Service) bool {
+	return service.GetStatus() == koyeb.SERVICESTATUS_DELETING || service.GetStatus() == koyeb.SERVICESTATUS_DELETED
+}
+
+func (f *fakeAPI) listDeployments(w http.ResponseWriter, r *http.Request) {
+	deployments := []koyeb.DeploymentListItem{}
+	for _, deployment := range fakeSorted(f.deployments) {
+		if appId := r.URL.Query().Get("app_id"); appId != "" && deployment.GetAppId() != appId {
+			continue
+		}
+		if serviceId := r.URL.Query().Get("service_id"); serviceId != "" && deployment.GetServiceId() != serviceId {
+			continue
+		}
+
+		deployments = append(deployments, koyeb.DeploymentListItem{
+			Id:              deployment.Id,
+			OrganizationId:  deployment.OrganizationId,
+			AppId:           deployment.AppId,
+			ServiceId:       deployment.ServiceId,
+			ParentId:        deployment.ParentId,
+			Status:          deployment.Status,
+			Definition:      deployment.Definition,
+			Messages:        deployment.Messages,
+			Version:         deployment.Version,
+			DeploymentGroup: deployment.DeploymentGroup,
+			CreatedAt:       deployment.CreatedAt,
+			UpdatedAt:       deployment.UpdatedAt,
+			StartedAt:       deployment.StartedAt,
+			SucceededAt:     deployment.SucceededAt,
+			TerminatedAt:    deployment.TerminatedAt,
+		})
+	}
+
+	deployments, limit, offset, count := fakePage(r, deployments)
+	fakeReply(w, koyeb.ListDeploymentsReply{Deployments: &deployments, Limit: &limit, Offset: &offset, Count: &count})
+}
+
+func (f *fakeAPI) getDeployment(w http.ResponseWriter, r *http.Request) {
+	deployment, ok := f.deployments[r.PathValue("id")]
+	if !ok {
+		fakeNotFound(w, "deployment")
+		return
+	}
+
+	fakeReply(w, koyeb.GetDeploymentReply{Deployment: deployment})
+}
+
+func (f *fakeAPI) createDomain(w http.ResponseWriter, r *http.Request) {
+	var body koyeb.CreateDomain
+	if !fakeDecode(w, r, &body) {
+		return
+	}
+
+	domainType := koyeb.DOMAINTYPE_CUSTOM
+	if t, ok := body.GetTypeOk(); ok {
+		domainType = *t
+	}
+
+	if body.GetName() == "" {
+		fakeFieldError(w, "name", "must not be empty")
+		return
+	}
+	for _, domain := range f.domains {
+		if domain.GetName() == body.GetName() {
+			fakeFieldError(w, "name", "already exists")
+			return
+		}
+	}
+
+	if _, ok := f.apps[body.GetAppId()]; body.GetAppId() != "" && !ok {
+		fakeFieldError(w, "app_id", "app not found")
+		return
+	}
+
+	if domainType == koyeb.DOMAINTYPE_AUTOASSIGNED && (body.GetAppId() == "" || !strings.HasSuffix(body.GetName(), ".koyeb.app")) {
+		fakeFieldError(w, "name", "must be a koyeb.app subdomain assigned to an app")
+		return
+	}
+
+	fakeReply(w, koyeb.CreateDomainReply{Domain: f.addDomain(body.GetName(), domainType, body.GetAppId())})
+}
+
+func (f *fakeAPI) addDomain(name string, domainType koyeb.DomainType, appId string) *koyeb.Domain {
+	now := time.Now().UTC()
+	domain := &koyeb.Domain{
+		Id:              toOpt(fakeID()),
+		OrganizationId:  f.user.DefaultOrganizationId,
+		Name:            toOpt(name),
+		Type:            toOpt(domainType),
+		AppId:           toOpt(appId),
+		Status:          toOpt(koyeb.DOMAINSTATUS_PENDING),
+		DeploymentGroup: toOpt("prod"),
+		Version:         toOpt("1"),
+		CreatedAt:       &now,
+		UpdatedAt:       &now,
+	}
+
+	if domainType == koyeb.DOMAINTYPE_CUSTOM {
+		domain.IntendedCname = toOpt(fmt.Sprintf("%s.cname.koyeb.app", strings.Split(domain.GetId(), "-")[0]))
+		domain.Messages = &[]string{fmt.Sprintf("Waiting for the CNAME record of %s to point to %s", name, domain.GetIntendedCname())}
+	} else {
+		domain.Messages = &[]string{"Provisioning the domain"}
+	}
+
+	f.domains[domain.GetId()] = domain
+
+	return domain
+}
+
+func (f *fakeAPI) listDomains(w http.ResponseWriter, r *http.Request) {
+	domains := []koyeb.Domain{}
+	for _, domain := range fakeSorted(f.domains) {
+		if name := r.URL.Query().Get("name"); name != "" && domain.GetName() != name {
+			continue
+		}
+
+		domains = append(domains, *f.advanceDomain(domain))
+	}
+
+	domains, limit, offset, count := fakePage(r, domains)
+	fakeReply(w, koyeb.ListDomainsReply{Domains: &domains, Limit: &limit, Offset: &offset, Count: &count})
+}
+
+func (f *fakeAPI) getDomain(w http.ResponseWriter, r *http.Request) {
+	domain, ok := f.domains[r.PathValue("id")]
+	if !ok {
+		fakeNotFound(w, "domain")
+		return
+	}
+
+	fakeReply(w, koyeb.GetDomainReply{Domain: f.advanceDomain(domain)})
+}
+
+func (f *fakeAPI) updateDomain(w http.ResponseWriter, r *http.Request) {
+	domain, ok := f.domains[r.PathValue("id")]
+	if !ok {
+		fakeNotFound(w, "domain")
+		return
+	}
+
+	var body koyeb.UpdateDomain
+	if !fakeDecode(w, r, &body) {
+		return
+	}
+
+	if _, ok := f.apps[body.GetAppId()]; body.GetAppId() != "" && !ok {
+		fakeFieldError(w, "app_id", "app not found")
+		return
+	}
+
+	version, _ := strconv.Atoi(domain.GetVersion())
+	now := time.Now().UTC()
+	domain.AppId = toOpt(body.GetAppId())
+	domain.Version = toOpt(strconv.Itoa(version + 1))
+	domain.UpdatedAt = &now
+
+	fakeReply(w, koyeb.UpdateDomainReply{Domain: domain})
+}
+
+func (f *fakeAPI) deleteDomain(w http.ResponseWriter, r *http.Request) {
+	if _, ok := f.domains[r.PathValue("id")]; !ok {
+		fakeNotFound(w, "domain")
+		return
+	}
+
+	delete(f.domains, r.PathValue("id"))
+
+	fakeReply(w, map[string]interface{}{})
+}
+
+// advanceDomain verifies a pending domain once it resolves. Koyeb-provided
+// subdomains always resolve.
+func (f *fakeAPI) advanceDomain(domain *koyeb.Domain) *koyeb.Domain {
+	if domain.GetStatus() != koyeb.DOMAINSTATUS_PENDING {
+		return domain
+	}
+
+	if domain.GetType() == koyeb.DOMAINTYPE_AUTOASSIGNED || f.resolvable[domain.GetName()] {
+		now := time.Now().UTC()
+		domain.Status = toOpt(koyeb.DOMAINSTATUS_ACTIVE)
+		domain.Messages = &[]string{"Domain is active"}
+		domain.VerifiedAt = &now
+		domain.UpdatedAt = &now
+	}
+
+	return domain
+}
+
+func (f *fakeAPI) createSecret(w http.ResponseWriter, r *http.Request) {
+	var body koyeb.CreateSecret
+	if !fakeDecode(w, r, &body) {
+		return
+	}
+
+	if !f.validSecretName(w, body.GetName(), "") {
+		return
+	}
+
+	secretType := koyeb.SECRETTYPE_SIMPLE
+	if t, ok := body.GetTypeOk(); ok {
+		secretType = *t
+	}
+
+	now := time.Now().UTC()
+	secret := &koyeb.Secret{
+		Id:                     toOpt(fakeID()),
+		Name:                   body.Name,
+		OrganizationId:         f.user.DefaultOrganizationId,
+		Type:                   &secretType,
+		Value:                  body.Value,
+		DockerHubRegistry:      body.DockerHubRegistry,
+		PrivateRegistry:        body.PrivateRegistry,
+		DigitalOceanRegistry:   body.DigitalOceanRegistry,
+		GithubRegistry:         body.GithubRegistry,
+		GitlabRegistry:         body.GitlabRegistry,
+		GcpContainerRegistry:   body.GcpContainerRegistry,
+		AzureContainerRegistry: body.AzureContainerRegistry,
+		CreatedAt:              &now,
+		UpdatedAt:              &now,
+	}
+	f.secrets[secret.GetId()] = secret
+
+	fakeReply(w, koyeb.CreateSecretReply{Secret: fakeRedactSecret(secret)})
+}
+
+func (f *fakeAPI) listSecrets(w http.ResponseWriter, r *http.Request) {
+	secrets := []koyeb.Secret{}
+	for _, secret := range fakeSorted(f.secrets) {
+		if name := r.URL.Query().Get("name"); name != "" && secret.GetName() != name {
+			continue
+		}
+
+		secrets = append(secrets, *fakeRedactSecret(secret))
+	}
+
+	secrets, limit, offset, count := fakePage(r, secrets)
+	fakeReply(w, koyeb.ListSecretsReply{Secrets: &secrets, Limit: &limit, Offset: &offset, Count: &count})
+}
+
+func (f *fakeAPI) getSecret(w http.ResponseWriter, r *http.Request) {
+	secret, ok := f.secrets[r.PathValue("id")]
+	if !ok {
+		fakeNotFound(w, "secret")
+		return
+	}
+
+	fakeReply(w, koyeb.GetSecretReply{Secret: fakeRedactSecret(secret)})
+}
+
+func (f *fakeAPI) updateSecret(w http.ResponseWriter, r *http.Request) {
+	secret, ok := f.secrets[r.PathValue("id")]
+	if !ok {
+		fakeNotFound(w, "secret")
+		return
+	}
+
+	var body koyeb.Secret
+	if !fakeDecode(w, r, &body) {
+		return
+	}
+
+	if name, ok := body.GetNameOk(); ok {
+		if !f.validSecretName(w, *name, secret.GetId()) {
+			return
+		}
+		secret.Name = toOpt(*name)
+	}
+
+	if body.Value != nil {
+		secret.Value = body.Value
+	}
+	if body.DockerHubRegistry != nil {
+		secret.DockerHubRegistry = body.DockerHubRegistry
+	}
+	if body.PrivateRegistry != nil {
+		secret.PrivateRegistry = body.PrivateRegistry
+	}
+	if body.DigitalOceanRegistry != nil {
+		secret.DigitalOceanRegistry = body.DigitalOceanRegistry
+	}
+	if body.GithubRegistry != nil {
+		secret.GithubRegistry = body.GithubRegistry
+	}
+	if body.GitlabRegistry != nil {
+		secret.GitlabRegistry = body.GitlabRegistry
+	}
+	if body.GcpContainerRegistry != nil {
+		secret.GcpContainerRegistry = body.GcpContainerRegistry
+	}
+	if body.AzureContainerRegistry != nil {
+		secret.AzureContainerRegistry = body.AzureContainerRegistry
+	}
+
+	now := time.Now().UTC()
+	secret.UpdatedAt = &now
+
+	fakeReply(w, koyeb.UpdateSecretReply{Secret: fakeRedactSecret(secret)})
+}
+
+func (f *fakeAPI) deleteSecret(w http.ResponseWriter, r *http.Request) {
+	if _, ok := f.secrets[r.PathValue("id")]; !ok {
+		fakeNotFound(w, "secret")
+		return
+	}
+
+	delete(f.secrets, r.PathValue("id"))
+
+	fakeReply(w, map[string]interface{}{})
+}
+
+func (f *fakeAPI) validSecretName(w http.ResponseWriter, name string, id string) bool {
+	if name == "" {
+		fakeFieldError(w, "name", "must not be empty")
+		return false
+	}
+
+	for _, secret := range f.secrets {
+		if secret.GetName() == name && secret.GetId() != id {
+			fakeFieldError(w, "name", "already exists")
+			return false
+		}
+	}
+
+	return true
+}
+
+// fakeRedactSecret returns secret without its value, which the API never
+// returns.
+func fakeRedactSecret(secret *koyeb.Secret) *koyeb.Secret {
+	result := *secret
+	result.Value = nil
+
+	return &result
+}
+
+// fakeID returns a random UUIDv4, the format of the IDs of the API.
+func fakeID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// fakeSorted returns the resources of a collection sorted by ID, so pages
+// are stable.
+func fakeSorted[T any](collection map[string]*T) []*T {
+	ids := make([]string, 0, len(collection))
+	for id := range collection {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	result := make([]*T, len(ids))
+	for i, id := range ids {
+		result[i] = collection[id]
+	}
+
+	return result
+}
+
+// fakePage returns the page of items selected by the limit and offset query
+// parameters, along with the total count.
+func fakePage[T any](r *http.Request, items []T) ([]T, int64, int64, int64) {
+	limit, err := strconv.ParseInt(r.URL.Query().Get("limit"), 10, 64)
+	if err != nil || limit <= 0 {
+		limit = 10
+	}
+	offset, err := strconv.ParseInt(r.URL.Query().Get("offset"), 10, 64)
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+
+	count := int64(len(items))
+	start := offset
+	if start > count {
+		start = count
+	}
+	end := start + limit
+	if end > count {
+		end = count
+	}
+
+	return items[start:end], limit, offset, count
+}
+
+func fakeDecode(w http.ResponseWriter, r *http.Request, body interface{}) bool {
+	if err := json.NewDecoder(r.Body).Decode(body); err != nil {
+		fakeError(w, http.StatusBadRequest, "invalid_argument", fmt.Sprintf("Invalid body: %s", err))
+		return false
+	}
+
+	return true
+}
+
+func fakeReply(w http.ResponseWriter, reply interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(reply)
+}
+
+func fakeNotFound(w http.ResponseWriter, kind string) {
+	fakeError(w, http.StatusNotFound, "not_found", fmt.Sprintf("%s not found", kind))
+}
+
+func fakeFieldError(w http.ResponseWriter, field string, description string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":  http.StatusBadRequest,
+		"code":    "invalid_argument",
+		"message": "Validation error",
+		"fields":  []map[string]string{{"field": field, "description": description}},
+	})
+}
+
+func fakeError(w http.ResponseWriter, status int, code string, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":  status,
+		"code":    code,
+		"message": message,
+	})
+}
+
+func TestFakeAPI_StatusTransitions(t *testing.T) {
+	ctx := context.Background()
+	api := newFakeAPI()
+	server := httptest.NewServer(api)
+	t.Cleanup(server.Close)
+
+	config := koyeb.NewConfiguration()
+	config.DefaultHeader["Authorization"] = "Bearer " + fakeAPIToken
+	if err := setAPIURL(config, server.URL); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	client := newClient(koyeb.NewAPIClient(config))
+
+	if err := client.loadAccount(ctx); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	app, _, err := client.AppsApi.CreateApp(ctx).Body(koyeb.CreateApp{Name: toOpt("app")}).Execute()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	service, _, err := client.ServicesApi.CreateService(ctx).Body(koyeb.CreateService{
+		AppId:      app.App.Id,
+		Definition: &koyeb.DeploymentDefinition{Name: toOpt("main"), Docker: &koyeb.DockerSource{Image: toOpt("koyeb/demo")}},
+	}).Execute()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if service.Service.GetStatus() != koyeb.SERVICESTATUS_STARTING {
+		t.Fatalf("expected a starting service, got %s", service.Service.GetStatus())
+	}
+
+	serviceWaiter := serviceStatusWaiter(client, service.Service.GetId())
+	serviceWaiter.Pending = []string{string(koyeb.SERVICESTATUS_STARTING)}
+	serviceWaiter.Target = []string{string(koyeb.SERVICESTATUS_HEALTHY)}
+	if res, err := serviceWaiter.Wait(ctx); err != nil || res.Service.GetActiveDeploymentId() != service.Service.GetLatestDeploymentId() {
+		t.Fatalf("expected the service to become healthy with its deployment active, got %+v, %v", res.Service, err)
+	}
+
+	domain, _, err := client.DomainsApi.CreateDomain(ctx).Body(koyeb.CreateDomain{Name: toOpt("example.com"), AppId: app.App.Id}).Execute()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	domainWaiter := domainStatusWaiter(client, domain.Domain.GetId())
+	domainWaiter.Pending = []string{string(koyeb.DOMAINSTATUS_PENDING)}
+	domainWaiter.Target = []string{string(koyeb.DOMAINSTATUS_ACTIVE)}
+	domainWaiter.MinInterval = time.Millisecond
+
+	waitCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if _, err := domainWaiter.Wait(waitCtx); err == nil {
+		t.Fatal("expected the domain to stay pending until its CNAME record is configured")
+	}
+
+	api.resolve("example.com")
+	if res, err := domainWaiter.Wait(ctx); err != nil || res.Domain.VerifiedAt == nil {
+		t.Fatalf("expected the domain to be verified, got %+v, %v", res.Domain, err)
+	}
+
+	if _, _, err := client.ServicesApi.DeleteService(ctx, service.Service.GetId()).Execute(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	serviceWaiter.Pending = []string{string(koyeb.SERVICESTATUS_DELETING)}
+	serviceWaiter.Target = []string{string(koyeb.SERVICESTATUS_DELETED)}
+	if _, err := serviceWaiter.Wait(ctx); err != nil {
+		t.Fatalf("expected the service to be deleted, got %v", err)
+	}
+	if _, resp, _ := client.ServicesApi.GetService(ctx, service.Service.GetId()).Execute(); resp == nil || resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected the deleted service to be gone, got %v", resp)
+	}
+}
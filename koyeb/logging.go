@@ -0,0 +1,241 @@
+package koyeb
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"golang.org/x/exp/slices"
+)
+
+// apiLogSubsystem is the logging subsystem of the API requests. Its level can
+// be set independently with the TF_LOG_PROVIDER_KOYEB_API environment variable.
+const apiLogSubsystem = "api"
+
+const redactedValue = "***"
+
+// redactedHeaders are the request headers never written to the logs.
+var redactedHeaders = []string{"Authorization"}
+
+// redactedFields are the JSON fields of request and response bodies holding
+// secret values or registry credentials. The value of a plain environment
+// variable is kept, see isPlainEnv.
+var redactedFields = []string{"value", "password", "token"}
+
+// apiLogLevelEnvs are the environment variables setting the level of the API
+// logs, from the most specific one.
+var apiLogLevelEnvs = []string{"TF_LOG_PROVIDER_KOYEB_API", "TF_LOG_PROVIDER_KOYEB", "TF_LOG_PROVIDER", "TF_LOG"}
+
+// withLogging annotates the logs of every operation of resource, including
+// the API requests it makes, with the resource type, its ID and the operation.
+func withLogging(resourceType string, resource *schema.Resource) *schema.Resource {
+	wrap := func(operation string, fn func(context.Context, *schema.ResourceData, interface{}) diag.Diagnostics) func(context.Context, *schema.ResourceData, interface{}) diag.Diagnostics {
+		if fn == nil {
+			return nil
+		}
+
+		return func(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+			return fn(loggingContext(ctx, resourceType, d.Id(), operation), d, meta)
+		}
+	}
+
+	resource.CreateContext = wrap("create", resource.CreateContext)
+	resource.ReadContext = wrap("read", resource.ReadContext)
+	resource.UpdateContext = wrap("update", resource.UpdateContext)
+	resource.DeleteContext = wrap("delete", resource.DeleteContext)
+
+	if customizeDiff := resource.CustomizeDiff; customizeDiff != nil {
+		resource.CustomizeDiff = func(ctx context.Context, d *schema.ResourceDiff, meta interface{}) error {
+			return customizeDiff(loggingContext(ctx, resourceType, d.Id(), "plan"), d, meta)
+		}
+	}
+
+	return resource
+}
+
+func loggingContext(ctx context.Context, resourceType string, id string, operation string) context.Context {
+	ctx = tflog.SetField(ctx, "koyeb_resource_type", resourceType)
+	ctx = tflog.SetField(ctx, "koyeb_resource_id", id)
+	ctx = tflog.SetField(ctx, "koyeb_operation", operation)
+
+	return tflog.NewSubsystem(ctx, apiLogSubsystem, tflog.WithRootFields(), tflog.WithLevelFromEnv("TF_LOG_PROVIDER_KOYEB", apiLogSubsystem))
+}
+
+// loggingTransport logs every API request with its status and latency at the
+// DEBUG level, and its headers and bodies at the TRACE level. Credentials and
+// secret values are redacted.
+type loggingTransport struct {
+	next http.RoundTripper
+}
+
+func newLoggingTransport(next http.RoundTripper) *loggingTransport {
+	return &loggingTransport{next: next}
+}
+
+func (t *loggingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	fields := map[string]interface{}{
+		"http_method": req.Method,
+		"http_path":   req.URL.Path,
+	}
+
+	// The bodies are only read when they are logged
+	trace := apiTraceEnabled()
+
+	if trace {
+		requestBody, err := peekRequestBody(req)
+		if err != nil {
+			return nil, err
+		}
+
+		tflog.SubsystemTrace(ctx, apiLogSubsystem, "Sending API request", fields, map[string]interface{}{
+			"http_request_headers": redactHeaders(req.Header),
+			"http_request_body":    redactBody(requestBody),
+		})
+	}
+
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	fields["latency_ms"] = time.Since(start).Milliseconds()
+
+	if err != nil {
+		tflog.SubsystemDebug(ctx, apiLogSubsystem, "API request failed", fields, map[string]interface{}{"error": err.Error()})
+		return nil, err
+	}
+
+	fields["http_status"] = resp.StatusCode
+	tflog.SubsystemDebug(ctx, apiLogSubsystem, "API request", fields)
+
+	if !trace {
+		return resp, nil
+	}
+
+	responseBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(responseBody))
+
+	tflog.SubsystemTrace(ctx, apiLogSubsystem, "Received API response", fields, map[string]interface{}{
+		"http_response_headers": redactHeaders(resp.Header),
+		"http_response_body":    redactBody(responseBody),
+	})
+
+	return resp, nil
+}
+
+// apiTraceEnabled reports whether the API logs are written at the TRACE level.
+// tflog doesn't expose the level of a logger, so it is read from the same
+// environment variables as terraform.
+func apiTraceEnabled() bool {
+	for _, name := range apiLogLevelEnvs {
+		if level := strings.ToUpper(os.Getenv(name)); level != "" {
+			return level == "TRACE" || level == "JSON"
+		}
+	}
+
+	return false
+}
+
+// peekRequestBody returns the body of req, leaving it readable for the next
+// transport.
+func peekRequestBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+
+	if req.GetBody != nil {
+		copy, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		defer copy.Close()
+
+		return io.ReadAll(copy)
+	}
+
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+
+	return body, nil
+}
+
+func redactHeaders(headers http.Header) map[string]string {
+	redacted := make(map[string]string, len(headers))
+	for name, values := range headers {
+		if slices.Contains(redactedHeaders, http.CanonicalHeaderKey(name)) {
+			redacted[name] = redactedValue
+		} else {
+			redacted[name] = strings.Join(values, ", ")
+		}
+	}
+
+	return redacted
+}
+
+// redactBody returns body with the values of the redactedFields masked. Bodies
+// which are not JSON are not logged since they can't be inspected.
+func redactBody(body []byte) string {
+	if len(body) == 0 {
+		return ""
+	}
+
+	var value interface{}
+	if err := json.Unmarshal(body, &value); err != nil {
+		return "<non-JSON body redacted>"
+	}
+
+	redacted, err := json.Marshal(redactValue(value))
+	if err != nil {
+		return "<body redacted>"
+	}
+
+	return string(redacted)
+}
+
+func redactValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, field := range v {
+			switch {
+			case strings.ToLower(key) == "value" && isPlainEnv(v):
+				// Plain environment variables are logged as is
+			case slices.Contains(redactedFields, strings.ToLower(key)):
+				v[key] = redactedValue
+			default:
+				v[key] = redactValue(field)
+			}
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = redactValue(item)
+		}
+	}
+
+	return value
+}
+
+// isPlainEnv reports whether object is an environment variable of a
+// deployment definition which doesn't reference a secret, and whose value is
+// therefore not a secret.
+func isPlainEnv(object map[string]interface{}) bool {
+	if _, ok := object["key"].(string); !ok {
+		return false
+	}
+
+	secret, _ := object["secret"].(string)
+	return secret == ""
+}
@@ -0,0 +1,206 @@
+package koyeb
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-log/tflogtest"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+func TestLoggingTransport_RedactsCredentials(t *testing.T) {
+	t.Setenv("TF_LOG_PROVIDER_KOYEB_API", "TRACE")
+
+	const payload = `{"name":"registry","docker_hub_registry":{"username":"user","password":"hunter2"},"value":"s3cr3t"}`
+
+	var received string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received = string(body)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(body)
+	}))
+	t.Cleanup(server.Close)
+
+	var output bytes.Buffer
+	ctx := loggingContext(tflogtest.RootLogger(context.Background(), &output), "koyeb_secret", "secret-id", "create")
+
+	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, server.URL+"/v1/secrets", strings.NewReader(payload))
+	req.Header.Set("Authorization", "Bearer my-token")
+
+	client := &http.Client{Transport: newLoggingTransport(http.DefaultTransport)}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer resp.Body.Close()
+
+	if received != payload {
+		t.Fatalf("expected the server to receive the original body, got %q", received)
+	}
+	if body, _ := io.ReadAll(resp.Body); string(body) != payload {
+		t.Fatalf("expected the response body to be readable, got %q", body)
+	}
+
+	for _, secret := range []string{"hunter2", "s3cr3t", "my-token"} {
+		if strings.Contains(output.String(), secret) {
+			t.Errorf("expected %q to be redacted from the logs", secret)
+		}
+	}
+
+	entries, err := tflogtest.MultilineJSONDecode(&output)
+	if err != nil {
+		t.Fatalf("unexpected error decoding the logs: %s", err)
+	}
+
+	found := false
+	for _, entry := range entries {
+		if entry["@message"] != "API request" {
+			continue
+		}
+		found = true
+
+		if entry["@level"] != "debug" || entry["http_method"] != "POST" || entry["http_path"] != "/v1/secrets" || entry["http_status"] != float64(200) {
+			t.Errorf("unexpected API request log entry: %v", entry)
+		}
+		if entry["koyeb_resource_type"] != "koyeb_secret" || entry["koyeb_resource_id"] != "secret-id" || entry["koyeb_operation"] != "create" {
+			t.Errorf("expected the resource fields on the API request log entry, got %v", entry)
+		}
+		if _, ok := entry["latency_ms"]; !ok {
+			t.Errorf("expected the latency on the API request log entry, got %v", entry)
+		}
+	}
+	if !found {
+		t.Fatalf("expected an API request log entry, got %v", entries)
+	}
+
+	for _, message := range []string{"Sending API request", "Received API response"} {
+		found = false
+		for _, entry := range entries {
+			found = found || entry["@message"] == message
+		}
+		if !found {
+			t.Errorf("expected a %q log entry at the TRACE level, got %v", message, entries)
+		}
+	}
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestLoggingTransport_ReadsBodiesOnlyAtTrace(t *testing.T) {
+	t.Setenv("TF_LOG_PROVIDER_KOYEB_API", "DEBUG")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"app":{"name":"app"}}`))
+	}))
+	t.Cleanup(server.Close)
+
+	var output bytes.Buffer
+	ctx := loggingContext(tflogtest.RootLogger(context.Background(), &output), "koyeb_app", "app-id", "read")
+
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/v1/apps/app-id", nil)
+
+	var received io.ReadCloser
+	next := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		resp, err := http.DefaultTransport.RoundTrip(req)
+		if resp != nil {
+			received = resp.Body
+		}
+		return resp, err
+	})
+
+	client := &http.Client{Transport: newLoggingTransport(next)}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.Body != received {
+		t.Errorf("expected the response body to be passed through without being buffered")
+	}
+	if body, _ := io.ReadAll(resp.Body); string(body) != `{"app":{"name":"app"}}` {
+		t.Fatalf("expected the response body to be readable, got %q", body)
+	}
+
+	entries, err := tflogtest.MultilineJSONDecode(&output)
+	if err != nil {
+		t.Fatalf("unexpected error decoding the logs: %s", err)
+	}
+	for _, entry := range entries {
+		if entry["@level"] == "trace" {
+			t.Errorf("expected no TRACE log entry, got %v", entry)
+		}
+	}
+}
+
+func TestRedactBody(t *testing.T) {
+	cases := []struct {
+		body     string
+		expected string
+	}{
+		{``, ``},
+		{`{"name":"app"}`, `{"name":"app"}`},
+		{`{"secret":{"name":"s","value":"v"}}`, `{"secret":{"name":"s","value":"***"}}`},
+		{`{"env":[{"key":"PORT","value":"8000"}]}`, `{"env":[{"key":"PORT","value":"8000"}]}`},
+		{`{"env":[{"key":"TOKEN","secret":"token","value":"v"}]}`, `{"env":[{"key":"TOKEN","secret":"token","value":"***"}]}`},
+		{`{"secrets":[{"Password":"p"},{"token":"t"}]}`, `{"secrets":[{"Password":"***"},{"token":"***"}]}`},
+		{`<html>`, `<non-JSON body redacted>`},
+	}
+
+	for _, c := range cases {
+		if got := redactBody([]byte(c.body)); got != c.expected {
+			t.Errorf("redactBody(%q) = %q, expected %q", c.body, got, c.expected)
+		}
+	}
+}
+
+func TestConfigure_LogsAPIRequestsInSubsystem(t *testing.T) {
+	server := httptest.NewServer(newFakeAPI())
+	t.Cleanup(server.Close)
+
+	t.Setenv("KOYEB_TOKEN", fakeAPIToken)
+	t.Setenv("KOYEB_API_URL", server.URL)
+
+	var output bytes.Buffer
+	ctx := tflogtest.RootLogger(context.Background(), &output)
+
+	p := newProvider("test", http.DefaultTransport)()
+	d := schema.TestResourceDataRaw(t, p.Schema, map[string]interface{}{})
+	if _, diags := p.ConfigureContextFunc(ctx, d); diags.HasError() {
+		t.Fatalf("unexpected error: %v", diags)
+	}
+
+	entries, err := tflogtest.MultilineJSONDecode(&output)
+	if err != nil {
+		t.Fatalf("unexpected error decoding the logs: %s", err)
+	}
+
+	found := false
+	for _, entry := range entries {
+		if entry["@message"] != "API request" {
+			continue
+		}
+		found = true
+
+		if entry["@module"] != "provider."+apiLogSubsystem {
+			t.Errorf("expected the API request to be logged in the %s subsystem, got %v", apiLogSubsystem, entry)
+		}
+		if _, ok := entry["new_logger_warning"]; ok {
+			t.Errorf("expected the %s subsystem to be initialised, got %v", apiLogSubsystem, entry)
+		}
+	}
+	if !found {
+		t.Fatalf("expected an API request log entry, got %v", entries)
+	}
+}
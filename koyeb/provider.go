@@ -3,10 +3,16 @@ package koyeb
 import (
 	"context"
 	"fmt"
+	"net/http"
+	"net/url"
 	"os"
+	"strings"
+	"time"
 
+	"github.com/hashicorp/terraform-plugin-log/tflog"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
 	"github.com/koyeb/koyeb-api-client-go/api/v1/koyeb"
 )
 
@@ -27,41 +33,114 @@ func init() {
 }
 
 func New(version string) func() *schema.Provider {
+	return newProvider(version, http.DefaultTransport)
+}
+
+// newProvider returns a provider sending its API requests with transport.
+func newProvider(version string, transport http.RoundTripper) func() *schema.Provider {
 	return func() *schema.Provider {
 		p := &schema.Provider{
+			Schema: map[string]*schema.Schema{
+				"max_retries": {
+					Type:         schema.TypeInt,
+					Optional:     true,
+					DefaultFunc:  schema.EnvDefaultFunc("KOYEB_MAX_RETRIES", 4),
+					Description:  "The maximum number of times a throttled or failed API request is retried. Can also be set with the `KOYEB_MAX_RETRIES` environment variable",
+					ValidateFunc: validation.IntAtLeast(0),
+				},
+				"retry_wait_max": {
+					Type:         schema.TypeInt,
+					Optional:     true,
+					DefaultFunc:  schema.EnvDefaultFunc("KOYEB_RETRY_WAIT_MAX", 30),
+					Description:  "The maximum number of seconds to wait between two retries of an API request. Can also be set with the `KOYEB_RETRY_WAIT_MAX` environment variable",
+					ValidateFunc: validation.IntAtLeast(1),
+				},
+				"max_concurrent_requests": {
+					Type:         schema.TypeInt,
+					Optional:     true,
+					DefaultFunc:  schema.EnvDefaultFunc("KOYEB_MAX_CONCURRENT_REQUESTS", 10),
+					Description:  "The maximum number of API requests sent concurrently by the provider. Can also be set with the `KOYEB_MAX_CONCURRENT_REQUESTS` environment variable",
+					ValidateFunc: validation.IntAtLeast(1),
+				},
+			},
 			DataSourcesMap: map[string]*schema.Resource{
-				"koyeb_app":     dataSourceKoyebApp(),
-				"koyeb_service": dataSourceKoyebService(),
-				"koyeb_domain":  dataSourceKoyebDomain(),
-				"koyeb_secret":  dataSourceKoyebSecret(),
+				"koyeb_app":     withLogging("koyeb_app", dataSourceKoyebApp()),
+				"koyeb_service": withLogging("koyeb_service", dataSourceKoyebService()),
+				"koyeb_domain":  withLogging("koyeb_domain", dataSourceKoyebDomain()),
+				"koyeb_secret":  withLogging("koyeb_secret", dataSourceKoyebSecret()),
 			},
 			ResourcesMap: map[string]*schema.Resource{
-				"koyeb_app":     resourceKoyebApp(),
-				"koyeb_service": resourceKoyebService(),
-				"koyeb_domain":  resourceKoyebDomain(),
-				"koyeb_secret":  resourceKoyebSecret(),
+				"koyeb_app":                 withLogging("koyeb_app", resourceKoyebApp()),
+				"koyeb_service":             withLogging("koyeb_service", resourceKoyebService()),
+				"koyeb_domain":              withLogging("koyeb_domain", resourceKoyebDomain()),
+				"koyeb_domain_verification": withLogging("koyeb_domain_verification", resourceKoyebDomainVerification()),
+				"koyeb_secrets":             withLogging("koyeb_secrets", resourceKoyebSecrets()),
 			},
 		}
 
-		p.ConfigureContextFunc = configure(p, version)
+		p.ConfigureContextFunc = configure(p, version, transport)
 
 		return p
 	}
 }
 
-func configure(p *schema.Provider, version string) func(context.Context, *schema.ResourceData) (interface{}, diag.Diagnostics) {
-	return func(context.Context, *schema.ResourceData) (interface{}, diag.Diagnostics) {
+func configure(p *schema.Provider, version string, transport http.RoundTripper) func(context.Context, *schema.ResourceData) (interface{}, diag.Diagnostics) {
+	return func(ctx context.Context, d *schema.ResourceData) (interface{}, diag.Diagnostics) {
 		if os.Getenv("KOYEB_TOKEN") == "" {
 			return nil, diag.Errorf("Empty KOYEB_TOKEN environment variable")
 		}
 
 		userAgent := p.UserAgent("terraform-provider-koyeb", version)
 		koyebClientConfig := koyeb.NewConfiguration()
-		koyebClientConfig.Host = "app.koyeb.com"
+		if err := setAPIURL(koyebClientConfig, os.Getenv("KOYEB_API_URL")); err != nil {
+			return nil, diag.Errorf("Error configuring the Koyeb client: %s", err)
+		}
 		koyebClientConfig.DefaultHeader["Authorization"] = fmt.Sprintf("Bearer %s", os.Getenv("KOYEB_TOKEN"))
 		koyebClientConfig.UserAgent = userAgent
+		koyebClientConfig.HTTPClient = &http.Client{
+			Transport: newRetryTransport(
+				newConcurrencyTransport(newLoggingTransport(transport), d.Get("max_concurrent_requests").(int)),
+				d.Get("max_retries").(int),
+				time.Duration(d.Get("retry_wait_max").(int))*time.Second,
+			),
+		}
+
+		client := newClient(koyeb.NewAPIClient(koyebClientConfig))
+		if err := client.loadAccount(loggingContext(ctx, "provider", "", "configure")); err != nil {
+			return nil, diag.Errorf("Error configuring the Koyeb client: %s", err)
+		}
+
+		tflog.Info(ctx, "Configured Koyeb client", map[string]interface{}{
+			"user_id":         client.User.GetId(),
+			"organization_id": client.OrganizationID,
+		})
 
-		client := koyeb.NewAPIClient(koyebClientConfig)
 		return client, nil
 	}
 }
+
+// defaultAPIURL is the URL of the Koyeb API. It can be overridden with the
+// KOYEB_API_URL environment variable, to send the requests to a proxy or to
+// the fake API used by the acceptance tests.
+const defaultAPIURL = "https://app.koyeb.com"
+
+// setAPIURL sets the scheme and the host the API requests are sent to. A URL
+// without a scheme is a host reached over HTTPS.
+func setAPIURL(config *koyeb.Configuration, apiURL string) error {
+	if apiURL == "" {
+		apiURL = defaultAPIURL
+	}
+	if !strings.Contains(apiURL, "://") {
+		apiURL = "https://" + apiURL
+	}
+
+	u, err := url.Parse(apiURL)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("invalid API URL %q", apiURL)
+	}
+
+	config.Scheme = u.Scheme
+	config.Host = u.Host
+
+	return nil
+}
@@ -0,0 +1,171 @@
+package koyeb
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/go-cty/cty"
+	"github.com/hashicorp/terraform-plugin-framework/datasource"
+	fwdiag "github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/hashicorp/terraform-plugin-framework/provider"
+	providerschema "github.com/hashicorp/terraform-plugin-framework/provider/schema"
+	"github.com/hashicorp/terraform-plugin-framework/providerserver"
+	"github.com/hashicorp/terraform-plugin-framework/resource"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/terraform-plugin-go/tfprotov5"
+	"github.com/hashicorp/terraform-plugin-mux/tf5muxserver"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+// NewMuxServer returns a server serving the SDK provider and the framework
+// provider side by side.
+func NewMuxServer(ctx context.Context, version string) (func() tfprotov5.ProviderServer, error) {
+	return newMuxServer(ctx, New(version)(), version)
+}
+
+func newMuxServer(ctx context.Context, sdkProvider *schema.Provider, version string) (func() tfprotov5.ProviderServer, error) {
+	muxServer, err := tf5muxserver.NewMuxServer(
+		ctx,
+		// The SDK provider must come first, it is configured before the
+		// framework provider which reuses its client
+		sdkProvider.GRPCProvider,
+		providerserver.NewProtocol5(newFrameworkProvider(sdkProvider, version)),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return muxServer.ProviderServer, nil
+}
+
+// frameworkProvider serves the resources implemented with the plugin
+// framework. It shares the client of the SDK provider, so both providers use
+// the same caches and request limits.
+type frameworkProvider struct {
+	sdkProvider *schema.Provider
+	version     string
+}
+
+var _ provider.Provider = &frameworkProvider{}
+
+func newFrameworkProvider(sdkProvider *schema.Provider, version string) provider.Provider {
+	return &frameworkProvider{
+		sdkProvider: sdkProvider,
+		version:     version,
+	}
+}
+
+func (p *frameworkProvider) Metadata(ctx context.Context, req provider.MetadataRequest, resp *provider.MetadataResponse) {
+	resp.TypeName = "koyeb"
+	resp.Version = p.version
+}
+
+// Schema mirrors the schema of the SDK provider, the mux server requires both
+// to be identical. The configuration is validated by the SDK provider.
+func (p *frameworkProvider) Schema(ctx context.Context, req provider.SchemaRequest, resp *provider.SchemaResponse) {
+	sdkSchema := p.sdkProvider.Schema
+	attributes := map[string]providerschema.Attribute{}
+
+	for name, s := range sdkSchema {
+		switch s.Type {
+		case schema.TypeInt:
+			attributes[name] = providerschema.Int64Attribute{
+				Optional:            s.Optional,
+				MarkdownDescription: s.Description,
+			}
+		case schema.TypeString:
+			attributes[name] = providerschema.StringAttribute{
+				Optional:            s.Optional,
+				MarkdownDescription: s.Description,
+			}
+		case schema.TypeBool:
+			attributes[name] = providerschema.BoolAttribute{
+				Optional:            s.Optional,
+				MarkdownDescription: s.Description,
+			}
+		default:
+			resp.Diagnostics.AddError(
+				"Unsupported provider attribute type",
+				fmt.Sprintf("The provider attribute %s has the type %s, which the framework provider schema does not handle.", name, s.Type),
+			)
+		}
+	}
+
+	resp.Schema = providerschema.Schema{Attributes: attributes}
+}
+
+func (p *frameworkProvider) Configure(ctx context.Context, req provider.ConfigureRequest, resp *provider.ConfigureResponse) {
+	client, ok := p.sdkProvider.Meta().(*Client)
+	if !ok {
+		resp.Diagnostics.AddError("Error configuring the Koyeb client", "The provider client was not configured")
+		return
+	}
+
+	resp.ResourceData = client
+	resp.DataSourceData = client
+}
+
+func (p *frameworkProvider) Resources(ctx context.Context) []func() resource.Resource {
+	return []func() resource.Resource{
+		newSecretResource,
+	}
+}
+
+func (p *frameworkProvider) DataSources(ctx context.Context) []func() datasource.DataSource {
+	return nil
+}
+
+// timeValue is the framework counterpart of flattenTime.
+func timeValue(t *time.Time, ok bool) types.String {
+	if formatted, isSet := flattenTime(t, ok).(string); isSet {
+		return types.StringValue(formatted)
+	}
+
+	return types.StringNull()
+}
+
+// frameworkDiagnostics converts SDK diagnostics, such as the ones returned by
+// apiErrorDiagnostics, to framework diagnostics.
+func frameworkDiagnostics(diags diag.Diagnostics) fwdiag.Diagnostics {
+	var result fwdiag.Diagnostics
+
+	for _, d := range diags {
+		attributePath := frameworkPath(d.AttributePath)
+
+		switch {
+		case d.Severity == diag.Warning && attributePath.Equal(path.Empty()):
+			result.AddWarning(d.Summary, d.Detail)
+		case d.Severity == diag.Warning:
+			result.AddAttributeWarning(attributePath, d.Summary, d.Detail)
+		case attributePath.Equal(path.Empty()):
+			result.AddError(d.Summary, d.Detail)
+		default:
+			result.AddAttributeError(attributePath, d.Summary, d.Detail)
+		}
+	}
+
+	return result
+}
+
+func frameworkPath(ctyPath cty.Path) path.Path {
+	result := path.Empty()
+
+	for _, step := range ctyPath {
+		switch s := step.(type) {
+		case cty.GetAttrStep:
+			result = result.AtName(s.Name)
+		case cty.IndexStep:
+			if s.Key.Type() == cty.String {
+				result = result.AtMapKey(s.Key.AsString())
+			} else {
+				index, _ := s.Key.AsBigFloat().Int64()
+				result = result.AtListIndex(int(index))
+			}
+		}
+	}
+
+	return result
+}
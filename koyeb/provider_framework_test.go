@@ -0,0 +1,99 @@
+package koyeb
+
+import (
+	"context"
+	"sort"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-framework/attr"
+	"github.com/hashicorp/terraform-plugin-framework/provider"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/terraform-plugin-go/tfprotov5"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+func TestMuxServer_Schema(t *testing.T) {
+	muxServer, err := newMuxServer(context.Background(), New("test")(), "test")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	resp, err := muxServer().GetProviderSchema(context.Background(), &tfprotov5.GetProviderSchemaRequest{})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	for _, d := range resp.Diagnostics {
+		if d.Severity == tfprotov5.DiagnosticSeverityError {
+			t.Errorf("unexpected error diagnostic: %s: %s", d.Summary, d.Detail)
+		}
+	}
+
+	secret, ok := resp.ResourceSchemas["koyeb_secret"]
+	if !ok {
+		t.Fatal("expected koyeb_secret to be served")
+	}
+
+	// The framework resource must keep the attributes of the SDK resource
+	// so the existing states can be read
+	got := []string{}
+	for _, a := range secret.Block.Attributes {
+		got = append(got, a.Name)
+	}
+	for _, b := range secret.Block.BlockTypes {
+		got = append(got, b.TypeName)
+	}
+	expected := []string{}
+	for name := range secretSchema() {
+		expected = append(expected, name)
+	}
+	sort.Strings(got)
+	sort.Strings(expected)
+
+	if len(got) != len(expected) {
+		t.Fatalf("expected attributes %v, got %v", expected, got)
+	}
+	for i := range got {
+		if got[i] != expected[i] {
+			t.Fatalf("expected attributes %v, got %v", expected, got)
+		}
+	}
+}
+
+func TestFrameworkProvider_Schema(t *testing.T) {
+	sdkProvider := &schema.Provider{
+		Schema: map[string]*schema.Schema{
+			"count":   {Type: schema.TypeInt, Optional: true},
+			"region":  {Type: schema.TypeString, Optional: true},
+			"enabled": {Type: schema.TypeBool, Optional: true},
+		},
+	}
+
+	resp := &provider.SchemaResponse{}
+	newFrameworkProvider(sdkProvider, "test").Schema(context.Background(), provider.SchemaRequest{}, resp)
+	if resp.Diagnostics.HasError() {
+		t.Fatalf("unexpected error: %v", resp.Diagnostics)
+	}
+
+	expected := map[string]attr.Type{
+		"count":   types.Int64Type,
+		"region":  types.StringType,
+		"enabled": types.BoolType,
+	}
+	for name, typ := range expected {
+		a, ok := resp.Schema.Attributes[name]
+		if !ok {
+			t.Fatalf("expected the %s attribute", name)
+		}
+		if !a.GetType().Equal(typ) {
+			t.Errorf("expected %s to have the type %s, got %s", name, typ, a.GetType())
+		}
+	}
+
+	sdkProvider.Schema["tags"] = &schema.Schema{Type: schema.TypeList, Optional: true, Elem: &schema.Schema{Type: schema.TypeString}}
+
+	resp = &provider.SchemaResponse{}
+	newFrameworkProvider(sdkProvider, "test").Schema(context.Background(), provider.SchemaRequest{}, resp)
+	if !resp.Diagnostics.HasError() {
+		t.Fatal("expected an error for an unsupported attribute type")
+	}
+}
@@ -3,29 +3,47 @@ package koyeb
 import (
 	"context"
 	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/hashicorp/go-cty/cty"
+	ctyjson "github.com/hashicorp/go-cty/cty/json"
+	"github.com/hashicorp/terraform-plugin-go/tfprotov5"
+	"github.com/hashicorp/terraform-plugin-go/tftypes"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/acctest"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+	"github.com/koyeb/koyeb-api-client-go/api/v1/koyeb"
 )
 
 const testNamePrefix = "tf-acc-test-"
 
 var testAccProvider *schema.Provider
 var testAccProviders map[string]*schema.Provider
-var testAccProviderFactories map[string]func() (*schema.Provider, error)
+var testAccProtoV5ProviderFactories map[string]func() (tfprotov5.ProviderServer, error)
 
 func init() {
-	testAccProvider = New("test")()
+	testAccProvider = newProvider("test", testAccVCR)()
 	testAccProviders = map[string]*schema.Provider{
 		"koyeb": testAccProvider,
 	}
-	testAccProviderFactories = map[string]func() (*schema.Provider, error){
-		"koyeb": func() (*schema.Provider, error) {
-			return testAccProvider, nil
+	testAccProtoV5ProviderFactories = map[string]func() (tfprotov5.ProviderServer, error){
+		"koyeb": func() (tfprotov5.ProviderServer, error) {
+			muxServer, err := newMuxServer(context.Background(), testAccProvider, "test")
+			if err != nil {
+				return nil, err
+			}
+
+			return muxServer(), nil
 		},
 	}
 }
@@ -35,7 +53,9 @@ func randomTestName(additionalNames ...string) string {
 	for _, n := range additionalNames {
 		prefix += "-" + strings.Replace(n, " ", "_", -1)
 	}
-	return randomName(prefix, 10)
+	return testAccVCR.name(callingTestName(), func() string {
+		return randomName(prefix, 10)
+	})
 }
 
 func randomName(prefix string, length int) string {
@@ -43,6 +63,8 @@ func randomName(prefix string, length int) string {
 }
 
 func testAccPreCheck(t *testing.T) {
+	testAccVCR.use(t)
+
 	if v := os.Getenv("KOYEB_TOKEN"); v == "" {
 		t.Fatal("KOYEB_TOKEN must be set for acceptance tests")
 	}
@@ -52,3 +74,141 @@ func testAccPreCheck(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+// testAPIClient returns an API client sending its requests to a stub server
+// answering with handler.
+func testAPIClient(t *testing.T, handler http.HandlerFunc) *Client {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	serverURL, _ := url.Parse(server.URL)
+	config := koyeb.NewConfiguration()
+	config.Scheme = serverURL.Scheme
+	config.Host = serverURL.Host
+
+	return newClient(koyeb.NewAPIClient(config))
+}
+
+// testUpgradeResourceState upgrades a state of the given schema version
+// written as JSON, the way Terraform does when reading an older state.
+func testUpgradeResourceState(t *testing.T, typeName string, version int64, rawState string) tftypes.Value {
+	ctx := context.Background()
+
+	muxServer, err := newMuxServer(ctx, New("test")(), "test")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	server := muxServer()
+
+	schemaResp, err := server.GetProviderSchema(ctx, &tfprotov5.GetProviderSchemaRequest{})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	resp, err := server.UpgradeResourceState(ctx, &tfprotov5.UpgradeResourceStateRequest{
+		TypeName: typeName,
+		Version:  version,
+		RawState: &tfprotov5.RawState{JSON: []byte(rawState)},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	for _, d := range resp.Diagnostics {
+		if d.Severity == tfprotov5.DiagnosticSeverityError {
+			t.Fatalf("unexpected error upgrading the state: %s: %s", d.Summary, d.Detail)
+		}
+	}
+
+	value, err := resp.UpgradedState.Unmarshal(schemaResp.ResourceSchemas[typeName].ValueType())
+	if err != nil {
+		t.Fatalf("unexpected error decoding the upgraded state: %s", err)
+	}
+
+	return value
+}
+
+// testStateFixture returns the raw state of testdata/states/name.json, stored
+// as written by a released version of the provider. The SDK doesn't decode
+// the JSON states with the schema of their version, the fixture is decoded
+// with priorType to check it still has the shape of the stored states.
+func testStateFixture(t *testing.T, name string, priorType cty.Type) string {
+	content, err := os.ReadFile(filepath.Join("testdata", "states", name+".json"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if priorType != cty.NilType {
+		if _, err := ctyjson.Unmarshal(content, priorType); err != nil {
+			t.Fatalf("cannot decode %s with the prior schema: %s", name, err)
+		}
+	}
+
+	return string(content)
+}
+
+// testStateAttribute returns the value at path in state, for instance
+// "definition.0.name".
+func testStateAttribute(t *testing.T, state tftypes.Value, path string) tftypes.Value {
+	attributePath := tftypes.NewAttributePath()
+	for _, step := range strings.Split(path, ".") {
+		if index, err := strconv.Atoi(step); err == nil {
+			attributePath = attributePath.WithElementKeyInt(index)
+		} else {
+			attributePath = attributePath.WithAttributeName(step)
+		}
+	}
+
+	value, _, err := tftypes.WalkAttributePath(state, attributePath)
+	if err != nil {
+		t.Fatalf("cannot find %s in the state: %s", path, err)
+	}
+
+	return value.(tftypes.Value)
+}
+
+func TestResourceFunctionsHonourContextCancellation(t *testing.T) {
+	client := testAPIClient(t, func(w http.ResponseWriter, r *http.Request) {
+		// The server only notices the client went away once the body is read
+		io.Copy(io.Discard, r.Body)
+
+		select {
+		case <-r.Context().Done():
+		case <-time.After(10 * time.Second):
+			w.WriteHeader(http.StatusOK)
+		}
+	})
+
+	cases := []struct {
+		name     string
+		resource *schema.Resource
+		fn       func(context.Context, *schema.ResourceData, interface{}) diag.Diagnostics
+		config   map[string]interface{}
+	}{
+		{"app read", resourceKoyebApp(), resourceKoyebAppRead, map[string]interface{}{"name": "app"}},
+		{"app delete", resourceKoyebApp(), resourceKoyebAppDelete, map[string]interface{}{"name": "app"}},
+		{"domain read", resourceKoyebDomain(), resourceKoyebDomainRead, map[string]interface{}{"name": "example.com"}},
+		{"service read", resourceKoyebService(), resourceKoyebServiceRead, map[string]interface{}{"app_name": "app"}},
+		{"service delete", resourceKoyebService(), resourceKoyebServiceDelete, map[string]interface{}{"app_name": "app"}},
+		{"app data source", dataSourceKoyebApp(), dataSourceKoyebAppRead, map[string]interface{}{"name": "app"}},
+		{"secret data source", dataSourceKoyebSecret(), dataSourceKoyebSecretRead, map[string]interface{}{"name": "secret"}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			d := schema.TestResourceDataRaw(t, c.resource.Schema, c.config)
+			d.SetId("00000000-0000-0000-0000-000000000000")
+
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+
+			start := time.Now()
+			diags := c.fn(ctx, d, client)
+			if !diags.HasError() {
+				t.Fatal("expected an error")
+			}
+			if elapsed := time.Since(start); elapsed > 5*time.Second {
+				t.Fatalf("request was not aborted by the context cancellation (took %s)", elapsed)
+			}
+		})
+	}
+}
@@ -2,9 +2,11 @@ package koyeb
 
 import (
 	"context"
-	"log"
+	"fmt"
+	"strings"
 	"time"
 
+	"github.com/hashicorp/terraform-plugin-log/tflog"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
@@ -21,7 +23,6 @@ func appSchema() map[string]*schema.Schema {
 		"name": {
 			Type:         schema.TypeString,
 			Required:     true,
-			ForceNew:     true,
 			Description:  "The app name",
 			ValidateFunc: validation.StringLenBetween(3, 23),
 		},
@@ -33,11 +34,22 @@ func appSchema() map[string]*schema.Schema {
 		"domains": {
 			Type: schema.TypeList,
 			Elem: &schema.Resource{
-				Schema: domainSchema(),
+				Schema: computedDomainSchema(),
 			},
 			Computed:    true,
 			Description: "The app domains",
 		},
+		"force_destroy": {
+			Type:        schema.TypeBool,
+			Optional:    true,
+			Default:     false,
+			Description: "Delete the services and custom domains of the app, including the ones not managed by Terraform, when the app is destroyed",
+		},
+		"public_url": {
+			Type:        schema.TypeString,
+			Computed:    true,
+			Description: "The public URL of the app, served by its Koyeb-provided subdomain",
+		},
 		"updated_at": {
 			Type:        schema.TypeString,
 			Computed:    true,
@@ -58,36 +70,94 @@ func resourceKoyebApp() *schema.Resource {
 		// This description is used by the documentation generator and the language server.
 		Description: "App resource in the Koyeb Terraform provider.",
 
+		SchemaVersion: 1,
+		StateUpgraders: []schema.StateUpgrader{
+			{
+				Version: 0,
+				Type:    resourceKoyebAppV0().CoreConfigSchema().ImpliedType(),
+				Upgrade: resourceKoyebAppStateUpgradeV0,
+			},
+		},
+
 		CreateContext: resourceKoyebAppCreate,
 		ReadContext:   resourceKoyebAppRead,
+		UpdateContext: resourceKoyebAppUpdate,
 		DeleteContext: resourceKoyebAppDelete,
 
+		Timeouts: &schema.ResourceTimeout{
+			Delete: schema.DefaultTimeout(10 * time.Minute),
+		},
+
 		Schema: appSchema(),
 	}
 }
 
+// resourceKoyebAppV0 is the schema of the app resource before force_destroy
+// was added. It is a frozen copy of the shape of the states written at
+// version 0, and must not be derived from the current schema, whose changes
+// would change it too.
+func resourceKoyebAppV0() *schema.Resource {
+	return &schema.Resource{
+		Schema: map[string]*schema.Schema{
+			"id":              {Type: schema.TypeString, Computed: true},
+			"name":            {Type: schema.TypeString, Required: true},
+			"organization_id": {Type: schema.TypeString, Computed: true},
+			"domains":         {Type: schema.TypeList, Computed: true, Elem: &schema.Resource{Schema: domainSchemaV0()}},
+			"updated_at":      {Type: schema.TypeString, Computed: true},
+			"created_at":      {Type: schema.TypeString, Computed: true},
+		},
+	}
+}
+
+// resourceKoyebAppStateUpgradeV0 sets the default of force_destroy in the
+// states written before it was added, which would otherwise plan an update to
+// set it.
+func resourceKoyebAppStateUpgradeV0(ctx context.Context, rawState map[string]interface{}, meta interface{}) (map[string]interface{}, error) {
+	if rawState == nil {
+		return rawState, nil
+	}
+
+	if _, ok := rawState["force_destroy"].(bool); !ok {
+		rawState["force_destroy"] = false
+	}
+
+	return rawState, nil
+}
+
 func setAppAttribute(d *schema.ResourceData, app koyeb.App) error {
 	d.SetId(app.GetId())
 	d.Set("name", app.GetName())
 	d.Set("organization_id", app.GetOrganizationId())
-	d.Set("created_at", app.GetCreatedAt().UTC().String())
-	d.Set("updated_at", app.GetUpdatedAt().UTC().String())
+	d.Set("created_at", flattenTime(app.GetCreatedAtOk()))
+	d.Set("updated_at", flattenTime(app.GetUpdatedAtOk()))
 	d.Set("domains", flattenDomains(app.Domains, app.GetName()))
+	d.Set("public_url", appPublicURL(app))
 
 	return nil
 }
 
+func appPublicURL(app koyeb.App) string {
+	for _, domain := range app.GetDomains() {
+		if domain.GetType() == koyeb.DOMAINTYPE_AUTOASSIGNED {
+			return fmt.Sprintf("https://%s", domain.GetName())
+		}
+	}
+
+	return ""
+}
+
 func resourceKoyebAppCreate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
-	client := meta.(*koyeb.APIClient)
+	client := meta.(*Client)
 
-	res, resp, err := client.AppsApi.CreateApp(context.Background()).Body(koyeb.CreateApp{
+	res, _, err := client.AppsApi.CreateApp(ctx).Body(koyeb.CreateApp{
 		Name: toOpt(d.Get("name").(string)),
 	}).Execute()
 	if err != nil {
-		return diag.Errorf("Error creating app: %s (%v %v)", err, resp, res)
+		return apiErrorDiagnostics("Error creating app", err, appSchema())
 	}
 
-	log.Printf("[INFO] Created app name: %s", *res.App.Name)
+	tflog.Info(ctx, "Created app", map[string]interface{}{"name": res.App.GetName(), "id": res.App.GetId()})
+	client.ids.set(idKindApp, res.App.GetName(), res.App.GetId())
 
 	setAppAttribute(d, *res.App)
 
@@ -95,18 +165,18 @@ func resourceKoyebAppCreate(ctx context.Context, d *schema.ResourceData, meta in
 }
 
 func resourceKoyebAppRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
-	client := meta.(*koyeb.APIClient)
+	client := meta.(*Client)
 
-	res, resp, err := client.AppsApi.GetApp(context.Background(), d.Id()).Execute()
+	res, resp, err := client.AppsApi.GetApp(ctx, d.Id()).Execute()
 	if err != nil {
 		// If the app is somehow already destroyed, mark as
 		// successfully gone
-		if resp.StatusCode == 404 {
+		if resp != nil && resp.StatusCode == 404 {
 			d.SetId("")
 			return nil
 		}
 
-		return diag.Errorf("Error retrieving app: %s (%v %v)", err, resp, res)
+		return apiErrorDiagnostics("Error retrieving app", err, appSchema())
 	}
 
 	setAppAttribute(d, *res.App)
@@ -114,35 +184,129 @@ func resourceKoyebAppRead(ctx context.Context, d *schema.ResourceData, meta inte
 	return nil
 }
 
-func resourceKoyebAppDelete(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
-	client := meta.(*koyeb.APIClient)
+func resourceKoyebAppUpdate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	client := meta.(*Client)
+
+	if d.HasChange("name") {
+		oldName, _ := d.GetChange("name")
 
-	for {
-		res, resp, err := client.ServicesApi.ListServices(context.Background()).AppId(d.Id()).Limit("100").Execute()
+		res, _, err := client.AppsApi.UpdateApp2(ctx, d.Id()).Body(koyeb.UpdateApp{
+			Name: toOpt(d.Get("name").(string)),
+		}).Execute()
 		if err != nil {
-			return diag.Errorf("Error retrieving app: %s (%v %v)", err, resp, res)
+			return apiErrorDiagnostics("Error updating app", err, appSchema())
 		}
-		if res.GetCount() == 0 {
-			break
-		}
-		for _, svc := range res.GetServices() {
+
+		tflog.Info(ctx, "Updated app", map[string]interface{}{"name": res.App.GetName()})
+		client.ids.forget(idKindApp, oldName.(string))
+		client.ids.set(idKindApp, res.App.GetName(), res.App.GetId())
+		client.secretUsage.forget()
+	}
+
+	return resourceKoyebAppRead(ctx, d, meta)
+}
+
+// serviceDeleted checks once whether the service is deleted, with a fresh
+// context so it still works once the context of the deletion expired.
+func serviceDeleted(ctx context.Context, client *Client, id string) bool {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 30*time.Second)
+	defer cancel()
+
+	res, resp, err := client.ServicesApi.GetService(ctx, id).Execute()
+	if err != nil {
+		return resp != nil && resp.StatusCode == 404
+	}
+
+	return res.Service.GetStatus() == koyeb.SERVICESTATUS_DELETED
+}
+
+func resourceKoyebAppDelete(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	client := meta.(*Client)
+	forceDestroy := d.Get("force_destroy").(bool)
+
+	services, err := client.ListServices(ctx, d.Id())
+	if err != nil {
+		return diag.Errorf("Error retrieving app services: %s", err)
+	}
+
+	if !forceDestroy {
+		remaining := []string{}
+		for _, svc := range services {
 			if svc.GetStatus() == koyeb.SERVICESTATUS_DELETING || svc.GetStatus() == koyeb.SERVICESTATUS_DELETED {
 				continue
 			}
+			remaining = append(remaining, svc.GetName())
+		}
+
+		if len(remaining) > 0 {
+			return diag.Errorf("Error deleting app: the app still contains the following services: %s. Delete them first or set force_destroy to true", strings.Join(remaining, ", "))
+		}
+	}
+
+	for _, svc := range services {
+		if svc.GetStatus() == koyeb.SERVICESTATUS_DELETING || svc.GetStatus() == koyeb.SERVICESTATUS_DELETED {
+			continue
+		}
+
+		_, resp, err := client.ServicesApi.DeleteService(ctx, svc.GetId()).Execute()
+		if err != nil && (resp == nil || resp.StatusCode != 404) {
+			return apiErrorDiagnostics(fmt.Sprintf("Error deleting app service %s", svc.GetName()), err, nil)
+		}
+	}
 
-			_, resp, err := client.ServicesApi.DeleteService(ctx, svc.GetId()).Execute()
+	// The context is bounded by the delete timeout. Once it expired, the
+	// remaining services are checked once with a fresh context, so the ones
+	// deleted meanwhile are not reported as stuck.
+	stuck := []string{}
+	for _, svc := range services {
+		waiter := serviceStatusWaiter(client, svc.GetId())
+		waiter.Target = []string{string(koyeb.SERVICESTATUS_DELETED)}
+		waiter.NotFoundIsTarget = true
+
+		if _, err := waiter.Wait(ctx); err != nil {
+			if ctx.Err() != nil && serviceDeleted(ctx, client, svc.GetId()) {
+				continue
+			}
+
+			tflog.Warn(ctx, "Service was not deleted", map[string]interface{}{"service_name": svc.GetName(), "error": err.Error()})
+			stuck = append(stuck, svc.GetName())
+		}
+	}
+
+	if len(stuck) > 0 {
+		return diag.Errorf("Error deleting app: the following services were not deleted before timeout: %s", strings.Join(stuck, ", "))
+	}
+
+	if forceDestroy {
+		res, _, err := client.AppsApi.GetApp(ctx, d.Id()).Execute()
+		if err != nil {
+			return apiErrorDiagnostics("Error retrieving app", err, appSchema())
+		}
+
+		// The autoassigned domain is deleted along with the app
+		for _, domain := range res.App.GetDomains() {
+			if domain.GetType() != koyeb.DOMAINTYPE_CUSTOM {
+				continue
+			}
+
+			_, _, err := client.DomainsApi.DeleteDomain(ctx, domain.GetId()).Execute()
 			if err != nil {
-				return diag.Errorf("Error deleting app: %s (%v %v", err, resp, res)
+				return apiErrorDiagnostics(fmt.Sprintf("Error deleting app domain %s", domain.GetName()), err, nil)
 			}
+
+			tflog.Info(ctx, "Deleted app domain", map[string]interface{}{"domain_name": domain.GetName()})
+			client.ids.forget(idKindDomain, domain.GetName())
 		}
-		time.Sleep(2 * time.Second)
 	}
 
-	res, resp, err := client.AppsApi.DeleteApp(context.Background(), d.Id()).Execute()
+	_, _, err = client.AppsApi.DeleteApp(ctx, d.Id()).Execute()
 	if err != nil {
-		return diag.Errorf("Error deleting app: %s (%v %v)", err, resp, res)
+		return apiErrorDiagnostics("Error deleting app", err, appSchema())
 	}
 
+	client.ids.forget(idKindApp, d.Get("name").(string))
+	client.secretUsage.forget()
+
 	d.SetId("")
 	return nil
 }
@@ -4,10 +4,15 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"net/http"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/terraform-plugin-go/tftypes"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
 	"github.com/koyeb/koyeb-api-client-go/api/v1/koyeb"
 )
@@ -16,6 +21,9 @@ func init() {
 	resource.AddTestSweepers("koyeb_app", &resource.Sweeper{
 		Name: "koyeb_app",
 		F:    testSweepApp,
+		// The services are swept first to wait for their deletion, and the
+		// custom domains so none is left detached
+		Dependencies: []string{"koyeb_service", "koyeb_deployment", "koyeb_domain"},
 	})
 
 }
@@ -26,24 +34,101 @@ func testSweepApp(string) error {
 		return err
 	}
 
-	client := meta.(*koyeb.APIClient)
+	client := meta.(*Client)
+	ctx := context.Background()
 
-	res, _, err := client.AppsApi.ListApps(context.Background()).Limit("100").Execute()
+	apps, err := sweepApps(ctx, client)
 	if err != nil {
 		return err
 	}
 
-	for _, a := range *res.Apps {
-		if strings.HasPrefix(a.GetName(), testNamePrefix) {
-			log.Printf("Destroying app %s", *a.Name)
+	var result *multierror.Error
+	for id, name := range apps {
+		if !isTestName(name) {
+			continue
+		}
+
+		log.Printf("Destroying app %s", name)
 
-			if _, _, err := client.AppsApi.DeleteApp(context.Background(), a.GetId()).Execute(); err != nil {
-				return err
-			}
+		if _, resp, err := client.AppsApi.DeleteApp(ctx, id).Execute(); err != nil && !sweepNotFound(resp) {
+			result = multierror.Append(result, fmt.Errorf("error deleting app %s: %w", name, err))
 		}
 	}
 
-	return nil
+	return result.ErrorOrNil()
+}
+
+func TestResourceKoyebAppStateUpgradeV0(t *testing.T) {
+	state := testUpgradeResourceState(t, "koyeb_app", 0, `{
+		"id": "app-id",
+		"name": "app",
+		"organization_id": "organization-id",
+		"domains": [],
+		"created_at": "2022-06-01 10:00:00 +0000 UTC",
+		"updated_at": "2022-06-01 10:00:00 +0000 UTC"
+	}`)
+
+	for path, expected := range map[string]tftypes.Value{
+		"name":          tftypes.NewValue(tftypes.String, "app"),
+		"force_destroy": tftypes.NewValue(tftypes.Bool, false),
+	} {
+		if value := testStateAttribute(t, state, path); !value.Equal(expected) {
+			t.Errorf("expected %s to be %s, got %s", path, expected, value)
+		}
+	}
+}
+
+func TestResourceKoyebAppStateUpgradeV0_Fixture(t *testing.T) {
+	rawState := testStateFixture(t, "koyeb_app_v0", resourceKoyebAppV0().CoreConfigSchema().ImpliedType())
+	state := testUpgradeResourceState(t, "koyeb_app", 0, rawState)
+
+	for path, expected := range map[string]tftypes.Value{
+		"name":           tftypes.NewValue(tftypes.String, "app"),
+		"domains.0.name": tftypes.NewValue(tftypes.String, "app-fake-organization.koyeb.app"),
+		"domains.0.type": tftypes.NewValue(tftypes.String, "AUTOASSIGNED"),
+		"force_destroy":  tftypes.NewValue(tftypes.Bool, false),
+	} {
+		if value := testStateAttribute(t, state, path); !value.Equal(expected) {
+			t.Errorf("expected %s to be %s, got %s", path, expected, value)
+		}
+	}
+}
+
+func TestResourceKoyebAppDelete_ChecksServicesAfterTimeout(t *testing.T) {
+	client := testAPIClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		switch {
+		case r.URL.Path == "/v1/services":
+			w.Write([]byte(`{"services": [
+				{"id": "draining", "name": "draining", "status": "HEALTHY"},
+				{"id": "deleted", "name": "deleted", "status": "HEALTHY"}
+			], "count": 2}`))
+		case r.Method == http.MethodDelete:
+			w.Write([]byte(`{}`))
+		case r.URL.Path == "/v1/services/draining":
+			w.Write([]byte(`{"service": {"id": "draining", "status": "DELETING"}}`))
+		case r.URL.Path == "/v1/services/deleted":
+			w.Write([]byte(`{"service": {"id": "deleted", "status": "DELETED"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+
+	d := schema.TestResourceDataRaw(t, resourceKoyebApp().Schema, map[string]interface{}{"name": "app", "force_destroy": true})
+	d.SetId(testAppID)
+
+	// The wait for the draining service uses up the timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+
+	diags := resourceKoyebAppDelete(ctx, d, client)
+	if !diags.HasError() {
+		t.Fatal("expected an error")
+	}
+	if summary := diags[0].Summary; !strings.HasSuffix(summary, "before timeout: draining") {
+		t.Errorf("expected only the draining service to be stuck, got %s", summary)
+	}
 }
 
 func TestAccKoyebApp_Basic(t *testing.T) {
@@ -51,9 +136,9 @@ func TestAccKoyebApp_Basic(t *testing.T) {
 	appName := randomTestName()
 
 	resource.ParallelTest(t, resource.TestCase{
-		PreCheck:          func() { testAccPreCheck(t) },
-		ProviderFactories: testAccProviderFactories,
-		CheckDestroy:      testAccCheckKoyebAppDestroy,
+		PreCheck:                 func() { testAccPreCheck(t) },
+		ProtoV5ProviderFactories: testAccProtoV5ProviderFactories,
+		CheckDestroy:             testAccCheckKoyebAppDestroy,
 		Steps: []resource.TestStep{
 			{
 				Config: fmt.Sprintf(testAccCheckKoyebAppConfig_basic, appName),
@@ -66,6 +151,7 @@ func TestAccKoyebApp_Basic(t *testing.T) {
 					resource.TestCheckResourceAttrSet("koyeb_app.foobar", "organization_id"),
 					resource.TestCheckResourceAttrSet("koyeb_app.foobar", "updated_at"),
 					resource.TestCheckResourceAttrSet("koyeb_app.foobar", "created_at"),
+					resource.TestCheckResourceAttrSet("koyeb_app.foobar", "public_url"),
 					resource.TestCheckResourceAttrSet("koyeb_app.foobar", "domains.0.id"),
 					resource.TestCheckResourceAttrSet("koyeb_app.foobar", "domains.0.app_name"),
 					resource.TestCheckResourceAttrSet("koyeb_app.foobar", "domains.0.created_at"),
@@ -79,12 +165,80 @@ func TestAccKoyebApp_Basic(t *testing.T) {
 					resource.TestCheckResourceAttrSet("koyeb_app.foobar", "domains.0.version"),
 				),
 			},
+			{
+				Config: fmt.Sprintf(testAccCheckKoyebAppConfig_basic, appName+"-r"),
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckKoyebAppRenamed("koyeb_app.foobar", &app),
+					resource.TestCheckResourceAttr(
+						"koyeb_app.foobar", "name", appName+"-r"),
+				),
+			},
 		},
 	})
 }
 
+func TestAccKoyebApp_ForceDestroy(t *testing.T) {
+	var app koyeb.App
+	appName := randomTestName()
+
+	resource.ParallelTest(t, resource.TestCase{
+		PreCheck:                 func() { testAccPreCheck(t) },
+		ProtoV5ProviderFactories: testAccProtoV5ProviderFactories,
+		CheckDestroy:             testAccCheckKoyebAppDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: fmt.Sprintf(testAccCheckKoyebAppConfig_force_destroy, appName),
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckKoyebAppExists("koyeb_app.foobar", &app),
+					resource.TestCheckResourceAttr("koyeb_app.foobar", "force_destroy", "true"),
+					testAccCreateKoyebAppUnmanagedService(&app),
+				),
+			},
+		},
+	})
+}
+
+// testAccCreateKoyebAppUnmanagedService creates a service outside of
+// Terraform, which force_destroy must clean up when the app is destroyed.
+func testAccCreateKoyebAppUnmanagedService(app *koyeb.App) resource.TestCheckFunc {
+	return func(s *terraform.State) error {
+		client := testAccProvider.Meta().(*Client)
+
+		_, _, err := client.ServicesApi.CreateService(context.Background()).Body(koyeb.CreateService{
+			AppId: app.Id,
+			Definition: &koyeb.DeploymentDefinition{
+				Name:          toOpt("unmanaged"),
+				Docker:        &koyeb.DockerSource{Image: toOpt("koyeb/demo")},
+				Ports:         &[]koyeb.DeploymentPort{{Port: toOpt(int64(3000)), Protocol: toOpt("http")}},
+				Routes:        &[]koyeb.DeploymentRoute{{Port: toOpt(int64(3000)), Path: toOpt("/")}},
+				InstanceTypes: &[]koyeb.DeploymentInstanceType{{Type: toOpt("micro")}},
+				Scalings:      &[]koyeb.DeploymentScaling{{Min: toOpt(int64(1)), Max: toOpt(int64(1))}},
+				Regions:       &[]string{"par"},
+			},
+		}).Execute()
+
+		return err
+	}
+}
+
+func testAccCheckKoyebAppRenamed(n string, app *koyeb.App) resource.TestCheckFunc {
+	return func(s *terraform.State) error {
+		rs, ok := s.RootModule().Resources[n]
+
+		if !ok {
+			return fmt.Errorf("Not found: %s", n)
+		}
+
+		if rs.Primary.ID != app.GetId() {
+			return fmt.Errorf("App was replaced instead of renamed: %s != %s", rs.Primary.ID, app.GetId())
+		}
+
+		return nil
+	}
+}
+
 func testAccCheckKoyebAppDestroy(s *terraform.State) error {
-	client := testAccProvider.Meta().(*koyeb.APIClient)
+	client := testAccProvider.Meta().(*Client)
 
 	for _, rs := range s.RootModule().Resources {
 		if rs.Type != "koyeb_app" {
@@ -122,7 +276,7 @@ func testAccCheckKoyebAppExists(n string, app *koyeb.App) resource.TestCheckFunc
 			return fmt.Errorf("No Record ID is set")
 		}
 
-		client := testAccProvider.Meta().(*koyeb.APIClient)
+		client := testAccProvider.Meta().(*Client)
 
 		res, _, err := client.AppsApi.GetApp(context.Background(), rs.Primary.ID).Execute()
 
@@ -144,3 +298,9 @@ const testAccCheckKoyebAppConfig_basic = `
 resource "koyeb_app" "foobar" {
 	name       = "%s"
 }`
+
+const testAccCheckKoyebAppConfig_force_destroy = `
+resource "koyeb_app" "foobar" {
+	name          = "%s"
+	force_destroy = true
+}`
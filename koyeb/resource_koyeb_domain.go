@@ -2,14 +2,16 @@ package koyeb
 
 import (
 	"context"
-	"log"
+	"fmt"
+	"net/http"
 	"strings"
+	"time"
 
+	"github.com/hashicorp/terraform-plugin-log/tflog"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
 	"github.com/koyeb/koyeb-api-client-go/api/v1/koyeb"
-	"github.com/koyeb/koyeb-cli/pkg/koyeb/idmapper"
 )
 
 func domainSchema() map[string]*schema.Schema {
@@ -50,8 +52,14 @@ func domainSchema() map[string]*schema.Schema {
 		},
 		"type": {
 			Type:        schema.TypeString,
+			Optional:    true,
 			Computed:    true,
-			Description: "The domain type",
+			ForceNew:    true,
+			Description: "The domain type, either `CUSTOM` or `AUTOASSIGNED` to manage the Koyeb-provided subdomain of the app. Defaults to `CUSTOM`",
+			ValidateFunc: validation.StringInSlice([]string{
+				string(koyeb.DOMAINTYPE_CUSTOM),
+				string(koyeb.DOMAINTYPE_AUTOASSIGNED),
+			}, false),
 		},
 		"intended_cname": {
 			Type:        schema.TypeString,
@@ -64,6 +72,18 @@ func domainSchema() map[string]*schema.Schema {
 			Computed:    true,
 			Description: "The status of the domain",
 		},
+		"wait_for_verification": {
+			Type:        schema.TypeBool,
+			Optional:    true,
+			Default:     false,
+			Description: "Wait for the domain to be verified and become active on creation. The creation only ends once the DNS records are in place, so they can't be created from `dns_records` in the same apply, use a `koyeb_domain_verification` resource instead",
+		},
+		"dns_records": {
+			Type:        schema.TypeList,
+			Computed:    true,
+			Description: "The DNS records to create for the domain to be verified. Only the CNAME record pointing the domain to `intended_cname` is included, which is the only record returned by the API",
+			Elem:        dnsRecordSchema(),
+		},
 		"messages": {
 			Type:        schema.TypeString,
 			Computed:    true,
@@ -91,6 +111,63 @@ func domainSchema() map[string]*schema.Schema {
 	return domain
 }
 
+// computedDomainSchema is the domain schema of the data source and of the app
+// domains, without the arguments that only apply to the resource and with
+// every attribute read from the API.
+func computedDomainSchema() map[string]*schema.Schema {
+	domain := domainSchema()
+	delete(domain, "wait_for_verification")
+
+	for _, attribute := range domain {
+		attribute.Required = false
+		attribute.Optional = false
+		attribute.Computed = true
+		attribute.ForceNew = false
+		attribute.ValidateFunc = nil
+	}
+
+	return domain
+}
+
+func dnsRecordSchema() *schema.Resource {
+	return &schema.Resource{
+		Schema: map[string]*schema.Schema{
+			"type": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "The DNS record type",
+			},
+			"name": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "The DNS record name",
+			},
+			"value": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "The DNS record value",
+			},
+		},
+	}
+}
+
+func flattenDNSRecords(domain *koyeb.Domain) []map[string]interface{} {
+	result := make([]map[string]interface{}, 0)
+
+	if domain.GetType() != koyeb.DOMAINTYPE_CUSTOM || domain.GetIntendedCname() == "" {
+		return result
+	}
+
+	r := make(map[string]interface{})
+	r["type"] = "CNAME"
+	r["name"] = domain.GetName()
+	r["value"] = domain.GetIntendedCname()
+
+	result = append(result, r)
+
+	return result
+}
+
 func flattenDomains(domains *[]koyeb.Domain, appName string) []map[string]interface{} {
 	result := make([]map[string]interface{}, len(*domains))
 
@@ -104,40 +181,111 @@ func flattenDomains(domains *[]koyeb.Domain, appName string) []map[string]interf
 		r["version"] = domain.GetVersion()
 		r["deployment_group"] = domain.GetDeploymentGroup()
 		r["organization_id"] = domain.GetOrganizationId()
-		r["created_at"] = domain.GetCreatedAt().UTC().String()
-		r["updated_at"] = domain.GetUpdatedAt().UTC().String()
+		r["created_at"] = flattenTime(domain.GetCreatedAtOk())
+		r["updated_at"] = flattenTime(domain.GetUpdatedAtOk())
 		r["app_name"] = appName
 		if messages, ok := domain.GetMessagesOk(); ok && len(domain.GetMessages()) > 0 {
 			r["messages"] = strings.Join(*messages, " ")
 		}
 
-		if verifiedAt, ok := domain.GetVerifiedAtOk(); ok {
-			r["verified_at"] = verifiedAt
-		}
+		r["verified_at"] = flattenTime(domain.GetVerifiedAtOk())
 
 		if intendedCname, ok := domain.GetIntendedCnameOk(); ok {
 			r["intended_cname"] = intendedCname
 		}
 
+		r["dns_records"] = flattenDNSRecords(&domain)
+
 		result[i] = r
 	}
 	return result
 }
 
+func domainStatusWaiter(client *Client, id string) statusWaiter[koyeb.GetDomainReply] {
+	return statusWaiter[koyeb.GetDomainReply]{
+		Resource: fmt.Sprintf("domain %s", id),
+		Refresh: func(ctx context.Context) (koyeb.GetDomainReply, *http.Response, error) {
+			return client.DomainsApi.GetDomain(ctx, id).Execute()
+		},
+		Status: func(res koyeb.GetDomainReply) string {
+			return string(res.Domain.GetStatus())
+		},
+		Messages: func(res koyeb.GetDomainReply) []string {
+			return res.Domain.GetMessages()
+		},
+	}
+}
+
 func resourceKoyebDomain() *schema.Resource {
 	return &schema.Resource{
 		// This description is used by the documentation generator and the language server.
 		Description: "Domain resource in the Koyeb Terraform provider.",
 
+		SchemaVersion: 1,
+		StateUpgraders: []schema.StateUpgrader{
+			{
+				Version: 0,
+				Type:    resourceKoyebDomainV0().CoreConfigSchema().ImpliedType(),
+				Upgrade: resourceKoyebDomainStateUpgradeV0,
+			},
+		},
+
 		CreateContext: resourceKoyebDomainCreate,
 		ReadContext:   resourceKoyebDomainRead,
 		UpdateContext: resourceKoyebDomainUpdate,
 		DeleteContext: resourceKoyebDomainDelete,
 
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(30 * time.Minute),
+		},
+
 		Schema: domainSchema(),
 	}
 }
 
+// resourceKoyebDomainV0 is the schema of the domain resource before
+// wait_for_verification was added. It is a frozen copy of the shape of the
+// states written at version 0, and must not be derived from the current
+// schema, whose changes would change it too.
+func resourceKoyebDomainV0() *schema.Resource {
+	return &schema.Resource{Schema: domainSchemaV0()}
+}
+
+// domainSchemaV0 is the domain schema at version 0, also used by the apps
+// of that version.
+func domainSchemaV0() map[string]*schema.Schema {
+	return map[string]*schema.Schema{
+		"id":               {Type: schema.TypeString, Computed: true},
+		"name":             {Type: schema.TypeString, Required: true},
+		"version":          {Type: schema.TypeString, Computed: true},
+		"deployment_group": {Type: schema.TypeString, Optional: true, Computed: true},
+		"organization_id":  {Type: schema.TypeString, Computed: true},
+		"app_name":         {Type: schema.TypeString, Optional: true},
+		"type":             {Type: schema.TypeString, Computed: true},
+		"intended_cname":   {Type: schema.TypeString, Optional: true, Computed: true},
+		"status":           {Type: schema.TypeString, Computed: true},
+		"messages":         {Type: schema.TypeString, Optional: true, Computed: true},
+		"verified_at":      {Type: schema.TypeString, Optional: true, Computed: true},
+		"updated_at":       {Type: schema.TypeString, Computed: true},
+		"created_at":       {Type: schema.TypeString, Computed: true},
+	}
+}
+
+// resourceKoyebDomainStateUpgradeV0 sets the default of wait_for_verification
+// in the states written before it was added, which would otherwise plan an
+// update to set it.
+func resourceKoyebDomainStateUpgradeV0(ctx context.Context, rawState map[string]interface{}, meta interface{}) (map[string]interface{}, error) {
+	if rawState == nil {
+		return rawState, nil
+	}
+
+	if _, ok := rawState["wait_for_verification"].(bool); !ok {
+		rawState["wait_for_verification"] = false
+	}
+
+	return rawState, nil
+}
+
 func setDomainAttribute(
 	d *schema.ResourceData,
 	domain *koyeb.Domain,
@@ -153,21 +301,20 @@ func setDomainAttribute(
 	d.Set("deployment_group", domain.GetDeploymentGroup())
 	d.Set("organization_id", domain.GetOrganizationId())
 	d.Set("intended_cname", domain.GetIntendedCname())
-	d.Set("verified_at", domain.GetVerifiedAt().UTC().String())
-	d.Set("created_at", domain.GetCreatedAt().UTC().String())
-	d.Set("updated_at", domain.GetUpdatedAt().UTC().String())
+	d.Set("dns_records", flattenDNSRecords(domain))
+	d.Set("verified_at", flattenTime(domain.GetVerifiedAtOk()))
+	d.Set("created_at", flattenTime(domain.GetCreatedAtOk()))
+	d.Set("updated_at", flattenTime(domain.GetUpdatedAtOk()))
 	d.Set("app_name", appName)
 	return nil
 }
 
 func resourceKoyebDomainCreate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
-	client := meta.(*koyeb.APIClient)
-	mapper := idmapper.NewMapper(context.Background(), client)
-	appMapper := mapper.App()
+	client := meta.(*Client)
 	var appId string
 
 	if d.Get("app_name").(string) != "" {
-		id, err := appMapper.ResolveID(d.Get("app_name").(string))
+		id, err := client.ResolveID(ctx, idKindApp, d.Get("app_name").(string))
 
 		if err != nil {
 			return diag.Errorf("Error creating domain: %s", err)
@@ -176,44 +323,93 @@ func resourceKoyebDomainCreate(ctx context.Context, d *schema.ResourceData, meta
 		appId = id
 	}
 
-	res, resp, err := client.DomainsApi.CreateDomain(context.Background()).Body(koyeb.CreateDomain{
+	domainType := koyeb.DOMAINTYPE_CUSTOM
+	if t, ok := d.GetOk("type"); ok {
+		domainType = koyeb.DomainType(t.(string))
+	}
+
+	var previousDomains []koyeb.Domain
+	if domainType == koyeb.DOMAINTYPE_AUTOASSIGNED {
+		if appId == "" {
+			return diag.Errorf("Error creating domain: app_name is required for AUTOASSIGNED domains")
+		}
+
+		res, _, err := client.AppsApi.GetApp(ctx, appId).Execute()
+		if err != nil {
+			return apiErrorDiagnostics("Error retrieving app assigned to domain", err, domainSchema())
+		}
+
+		for _, domain := range res.App.GetDomains() {
+			if domain.GetType() != koyeb.DOMAINTYPE_AUTOASSIGNED {
+				continue
+			}
+
+			// The app already has the requested subdomain, manage it as is
+			if domain.GetName() == d.Get("name").(string) {
+				d.SetId(domain.GetId())
+				tflog.Info(ctx, "Imported autoassigned domain", map[string]interface{}{"name": domain.GetName(), "id": domain.GetId()})
+				return resourceKoyebDomainRead(ctx, d, meta)
+			}
+
+			previousDomains = append(previousDomains, domain)
+		}
+	}
+
+	res, _, err := client.DomainsApi.CreateDomain(ctx).Body(koyeb.CreateDomain{
 		Name:  toOpt(d.Get("name").(string)),
 		AppId: &appId,
-		Type:  toOpt(koyeb.DOMAINTYPE_CUSTOM),
+		Type:  toOpt(domainType),
 	}).Execute()
 	if err != nil {
-		return diag.Errorf("Error creating domain: %s (%v %v)", err, resp, res)
+		return apiErrorDiagnostics("Error creating domain", err, domainSchema())
 	}
 
 	d.SetId(*res.Domain.Id)
-	log.Printf("[INFO] Created domain name: %s", *res.Domain.Name)
+	tflog.Info(ctx, "Created domain", map[string]interface{}{"name": res.Domain.GetName(), "id": res.Domain.GetId()})
+	client.ids.set(idKindDomain, res.Domain.GetName(), res.Domain.GetId())
+
+	// Renaming the Koyeb-provided subdomain replaces the one previously
+	// assigned to the app
+	for _, domain := range previousDomains {
+		_, _, err := client.DomainsApi.DeleteDomain(ctx, domain.GetId()).Execute()
+		if err != nil {
+			return apiErrorDiagnostics(fmt.Sprintf("Error deleting previous autoassigned domain %s", domain.GetName()), err, nil)
+		}
+
+		tflog.Info(ctx, "Deleted previous autoassigned domain", map[string]interface{}{"name": domain.GetName()})
+		client.ids.forget(idKindDomain, domain.GetName())
+	}
+
+	if d.Get("wait_for_verification").(bool) {
+		if _, err := domainVerificationWaiter(client, d.Id()).Wait(ctx); err != nil {
+			return diag.Errorf("Error waiting for domain to be verified: %s", err)
+		}
+	}
 
 	return resourceKoyebDomainRead(ctx, d, meta)
 }
 
 func resourceKoyebDomainRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
-	client := meta.(*koyeb.APIClient)
+	client := meta.(*Client)
 	appName := ""
 
-	res, resp, err := client.DomainsApi.GetDomain(context.Background(), d.Id()).Execute()
+	res, resp, err := client.DomainsApi.GetDomain(ctx, d.Id()).Execute()
 	if err != nil {
 		// If the domain is somehow already destroyed, mark as
 		// successfully gone
-		if resp.StatusCode == 404 {
+		if resp != nil && resp.StatusCode == 404 {
 			d.SetId("")
 			return nil
 		}
 
-		return diag.Errorf("Error retrieving domain: %s (%v %v)", err, resp, res)
+		return apiErrorDiagnostics("Error retrieving domain", err, domainSchema())
 	}
 
-	if *res.Domain.AppId != "" {
-		res, resp, err := client.AppsApi.GetApp(context.Background(), *res.Domain.AppId).Execute()
+	if res.Domain.GetAppId() != "" {
+		appName, err = client.AppName(ctx, res.Domain.GetAppId())
 		if err != nil {
-			return diag.Errorf("Error retrieving app assigned to domain: %s (%v %v)", err, resp, res)
+			return apiErrorDiagnostics("Error retrieving app assigned to domain", err, domainSchema())
 		}
-
-		appName = *res.App.Name
 	}
 
 	setDomainAttribute(d, res.Domain, appName)
@@ -222,13 +418,11 @@ func resourceKoyebDomainRead(ctx context.Context, d *schema.ResourceData, meta i
 }
 
 func resourceKoyebDomainUpdate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
-	client := meta.(*koyeb.APIClient)
-	mapper := idmapper.NewMapper(context.Background(), client)
-	appMapper := mapper.App()
+	client := meta.(*Client)
 	var appId string
 
 	if d.Get("app_name").(string) != "" {
-		id, err := appMapper.ResolveID(d.Get("app_name").(string))
+		id, err := client.ResolveID(ctx, idKindApp, d.Get("app_name").(string))
 
 		if err != nil {
 			return diag.Errorf("Error creating domain: %s", err)
@@ -237,25 +431,29 @@ func resourceKoyebDomainUpdate(ctx context.Context, d *schema.ResourceData, meta
 		appId = id
 	}
 
-	res, resp, err := client.DomainsApi.UpdateDomain(context.Background(), d.Id()).Body(koyeb.UpdateDomain{AppId: &appId}).Execute()
+	res, _, err := client.DomainsApi.UpdateDomain(ctx, d.Id()).Body(koyeb.UpdateDomain{AppId: &appId}).Execute()
 
 	if err != nil {
-		return diag.Errorf("Error retrieving domain: %s (%v %v)", err, resp, res)
+		return apiErrorDiagnostics("Error retrieving domain", err, domainSchema())
 	}
 
-	log.Printf("[INFO] Updated domain name: %s", *res.Domain.Name)
+	tflog.Info(ctx, "Updated domain", map[string]interface{}{"name": res.Domain.GetName()})
 	return resourceKoyebDomainRead(ctx, d, meta)
 }
 
 func resourceKoyebDomainDelete(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
-	client := meta.(*koyeb.APIClient)
+	client := meta.(*Client)
 
-	res, resp, err := client.DomainsApi.DeleteDomain(context.Background(), d.Id()).Execute()
+	// The domain may already be gone, e.g. an autoassigned domain replaced
+	// by the one created for the same app
+	_, resp, err := client.DomainsApi.DeleteDomain(ctx, d.Id()).Execute()
 
-	if err != nil {
-		return diag.Errorf("Error deleting domain: %s (%v %v)", err, resp, res)
+	if err != nil && (resp == nil || resp.StatusCode != 404) {
+		return apiErrorDiagnostics("Error deleting domain", err, domainSchema())
 	}
 
+	client.ids.forget(idKindDomain, d.Get("name").(string))
+
 	d.SetId("")
 	return nil
 }
@@ -4,47 +4,116 @@ import (
 	"context"
 	"fmt"
 	"log"
-	"strings"
+	"net/http"
 	"testing"
+	"time"
 
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/terraform-plugin-go/tftypes"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
 	"github.com/koyeb/koyeb-api-client-go/api/v1/koyeb"
 )
 
 func init() {
 	resource.AddTestSweepers("koyeb_domain", &resource.Sweeper{
-		Name:         "koyeb_domain",
-		F:            testSweepDomain,
-		Dependencies: []string{"koyeb_app"},
+		Name: "koyeb_domain",
+		F:    testSweepDomain,
 	})
 
 }
 
+// testSweepDomain deletes the custom domains of the tests. The autoassigned
+// domains are deleted along with their app.
 func testSweepDomain(string) error {
 	meta, err := sharedConfig()
 	if err != nil {
 		return err
 	}
 
-	client := meta.(*koyeb.APIClient)
+	client := meta.(*Client)
+	ctx := context.Background()
 
-	res, _, err := client.DomainsApi.ListDomains(context.Background()).Limit("100").Execute()
+	domains, err := sweepList(func(limit string, offset string) ([]koyeb.Domain, int64, error) {
+		res, _, err := client.DomainsApi.ListDomains(ctx).Limit(limit).Offset(offset).Execute()
+		return res.GetDomains(), res.GetCount(), err
+	})
 	if err != nil {
-		return err
+		return fmt.Errorf("error listing domains: %w", err)
 	}
 
-	for _, d := range *res.Domains {
-		if strings.HasPrefix(d.GetName(), testNamePrefix) {
-			log.Printf("Destroying domain %s", *d.Name)
+	var result *multierror.Error
+	for _, d := range domains {
+		if d.GetType() != koyeb.DOMAINTYPE_CUSTOM || !isTestName(d.GetName()) {
+			continue
+		}
+
+		log.Printf("Destroying domain %s", d.GetName())
 
-			if _, _, err := client.DomainsApi.DeleteDomain(context.Background(), d.GetId()).Execute(); err != nil {
-				return err
-			}
+		if _, resp, err := client.DomainsApi.DeleteDomain(ctx, d.GetId()).Execute(); err != nil && !sweepNotFound(resp) {
+			result = multierror.Append(result, fmt.Errorf("error deleting domain %s: %w", d.GetName(), err))
 		}
 	}
 
-	return nil
+	return result.ErrorOrNil()
+}
+
+func TestResourceKoyebDomainStateUpgradeV0(t *testing.T) {
+	state := testUpgradeResourceState(t, "koyeb_domain", 0, `{
+		"id": "domain-id",
+		"name": "example.com",
+		"app_name": "app",
+		"type": "CUSTOM",
+		"status": "ACTIVE",
+		"intended_cname": "app.koyeb.app",
+		"created_at": "2022-06-01 10:00:00 +0000 UTC",
+		"updated_at": "2022-06-01 10:00:00 +0000 UTC"
+	}`)
+
+	for path, expected := range map[string]tftypes.Value{
+		"name":                  tftypes.NewValue(tftypes.String, "example.com"),
+		"intended_cname":        tftypes.NewValue(tftypes.String, "app.koyeb.app"),
+		"wait_for_verification": tftypes.NewValue(tftypes.Bool, false),
+	} {
+		if value := testStateAttribute(t, state, path); !value.Equal(expected) {
+			t.Errorf("expected %s to be %s, got %s", path, expected, value)
+		}
+	}
+}
+
+func TestResourceKoyebDomainStateUpgradeV0_Fixture(t *testing.T) {
+	rawState := testStateFixture(t, "koyeb_domain_v0", resourceKoyebDomainV0().CoreConfigSchema().ImpliedType())
+	state := testUpgradeResourceState(t, "koyeb_domain", 0, rawState)
+
+	for path, expected := range map[string]tftypes.Value{
+		"name":                  tftypes.NewValue(tftypes.String, "example.com"),
+		"type":                  tftypes.NewValue(tftypes.String, "CUSTOM"),
+		"intended_cname":        tftypes.NewValue(tftypes.String, "5d6e7f80.cname.koyeb.app"),
+		"wait_for_verification": tftypes.NewValue(tftypes.Bool, false),
+	} {
+		if value := testStateAttribute(t, state, path); !value.Equal(expected) {
+			t.Errorf("expected %s to be %s, got %s", path, expected, value)
+		}
+	}
+}
+
+func TestResourceKoyebDomainDelete_AlreadyDeleted(t *testing.T) {
+	client := testAPIClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"status": 404, "code": "not_found", "message": "Domain not found"}`))
+	})
+
+	d := schema.TestResourceDataRaw(t, resourceKoyebDomain().Schema, map[string]interface{}{"name": "example.com"})
+	d.SetId("00000000-0000-0000-0000-000000000000")
+
+	if diags := resourceKoyebDomainDelete(context.Background(), d, client); diags.HasError() {
+		t.Fatalf("unexpected error: %v", diags)
+	}
+	if d.Id() != "" {
+		t.Errorf("expected the domain to be removed from the state")
+	}
 }
 
 func TestAccKoyebDomain_Basic(t *testing.T) {
@@ -53,9 +122,9 @@ func TestAccKoyebDomain_Basic(t *testing.T) {
 	domainName := appName + ".com"
 
 	resource.ParallelTest(t, resource.TestCase{
-		PreCheck:          func() { testAccPreCheck(t) },
-		ProviderFactories: testAccProviderFactories,
-		CheckDestroy:      testAccCheckKoyebDomainDestroy,
+		PreCheck:                 func() { testAccPreCheck(t) },
+		ProtoV5ProviderFactories: testAccProtoV5ProviderFactories,
+		CheckDestroy:             testAccCheckKoyebDomainDestroy,
 		Steps: []resource.TestStep{
 			{
 				Config: fmt.Sprintf(testAccCheckKoyebDomainConfig_basic, domainName),
@@ -71,9 +140,13 @@ func TestAccKoyebDomain_Basic(t *testing.T) {
 					resource.TestCheckResourceAttrSet("koyeb_domain.foo", "status"),
 					resource.TestCheckResourceAttrSet("koyeb_domain.foo", "messages"),
 					resource.TestCheckResourceAttrSet("koyeb_domain.foo", "version"),
-					resource.TestCheckResourceAttrSet("koyeb_domain.foo", "verified_at"),
+					resource.TestCheckNoResourceAttr("koyeb_domain.foo", "verified_at"),
 					resource.TestCheckResourceAttrSet("koyeb_domain.foo", "updated_at"),
 					resource.TestCheckResourceAttrSet("koyeb_domain.foo", "created_at"),
+					resource.TestCheckResourceAttr("koyeb_domain.foo", "dns_records.#", "1"),
+					resource.TestCheckResourceAttr("koyeb_domain.foo", "dns_records.0.type", "CNAME"),
+					resource.TestCheckResourceAttr("koyeb_domain.foo", "dns_records.0.name", domainName),
+					resource.TestCheckResourceAttrPair("koyeb_domain.foo", "dns_records.0.value", "koyeb_domain.foo", "intended_cname"),
 				),
 			},
 			{
@@ -90,7 +163,7 @@ func TestAccKoyebDomain_Basic(t *testing.T) {
 					resource.TestCheckResourceAttrSet("koyeb_domain.foo", "status"),
 					resource.TestCheckResourceAttrSet("koyeb_domain.foo", "messages"),
 					resource.TestCheckResourceAttrSet("koyeb_domain.foo", "version"),
-					resource.TestCheckResourceAttrSet("koyeb_domain.foo", "verified_at"),
+					resource.TestCheckNoResourceAttr("koyeb_domain.foo", "verified_at"),
 					resource.TestCheckResourceAttrSet("koyeb_domain.foo", "updated_at"),
 					resource.TestCheckResourceAttrSet("koyeb_domain.foo", "created_at"),
 					resource.TestCheckResourceAttrSet("koyeb_domain.foo", "app_name"),
@@ -100,8 +173,32 @@ func TestAccKoyebDomain_Basic(t *testing.T) {
 	})
 }
 
+func TestAccKoyebDomain_Autoassigned(t *testing.T) {
+	var domain koyeb.Domain
+	appName := randomTestName()
+	domainName := appName + "-renamed.koyeb.app"
+
+	resource.ParallelTest(t, resource.TestCase{
+		PreCheck:                 func() { testAccPreCheck(t) },
+		ProtoV5ProviderFactories: testAccProtoV5ProviderFactories,
+		CheckDestroy:             testAccCheckKoyebDomainDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: fmt.Sprintf(testAccCheckKoyebDomainConfig_autoassigned, appName, domainName),
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckKoyebDomainExists("koyeb_domain.foo", &domain),
+					testAccCheckKoyebDomainAttributes(&domain, domainName),
+					resource.TestCheckResourceAttr("koyeb_domain.foo", "type", "AUTOASSIGNED"),
+					resource.TestCheckResourceAttr("koyeb_domain.foo", "app_name", appName),
+					resource.TestCheckResourceAttr("koyeb_domain.foo", "dns_records.#", "0"),
+				),
+			},
+		},
+	})
+}
+
 func testAccCheckKoyebDomainDestroy(s *terraform.State) error {
-	client := testAccProvider.Meta().(*koyeb.APIClient)
+	client := testAccProvider.Meta().(*Client)
 	targetStatus := []string{"DELETED", "DELETING"}
 
 	for _, rs := range s.RootModule().Resources {
@@ -109,7 +206,13 @@ func testAccCheckKoyebDomainDestroy(s *terraform.State) error {
 			continue
 		}
 
-		err := waitForResourceStatus(client.DomainsApi.GetDomain(context.Background(), rs.Primary.ID).Execute, "Domain", targetStatus, 1, false)
+		waiter := domainStatusWaiter(client, rs.Primary.ID)
+		waiter.Target = targetStatus
+		waiter.NotFoundIsTarget = true
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		_, err := waiter.Wait(ctx)
+		cancel()
 		if err != nil {
 			return fmt.Errorf("Domain still exists: %s ", err)
 		}
@@ -140,7 +243,7 @@ func testAccCheckKoyebDomainExists(n string, domain *koyeb.Domain) resource.Test
 			return fmt.Errorf("No Record ID is set")
 		}
 
-		client := testAccProvider.Meta().(*koyeb.APIClient)
+		client := testAccProvider.Meta().(*Client)
 
 		res, _, err := client.DomainsApi.GetDomain(context.Background(), rs.Primary.ID).Execute()
 
@@ -172,3 +275,14 @@ resource "koyeb_domain" "foo" {
 	name       = "%s"
 	app_name   = "${koyeb_app.bar.name}"
 }`
+
+const testAccCheckKoyebDomainConfig_autoassigned = `
+resource "koyeb_app" "bar" {
+	name = "%s"
+}
+
+resource "koyeb_domain" "foo" {
+	name     = "%s"
+	type     = "AUTOASSIGNED"
+	app_name = koyeb_app.bar.name
+}`
@@ -0,0 +1,104 @@
+package koyeb
+
+import (
+	"context"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+	"github.com/koyeb/koyeb-api-client-go/api/v1/koyeb"
+)
+
+func domainVerificationSchema() map[string]*schema.Schema {
+	return map[string]*schema.Schema{
+		"domain_id": {
+			Type:         schema.TypeString,
+			Required:     true,
+			ForceNew:     true,
+			Description:  "The ID of the domain to wait for",
+			ValidateFunc: validation.NoZeroValues,
+		},
+		"status": {
+			Type:        schema.TypeString,
+			Computed:    true,
+			Description: "The status of the domain",
+		},
+		"verified_at": {
+			Type:        schema.TypeString,
+			Computed:    true,
+			Description: "The date and time of when the domain was last verified",
+		},
+	}
+}
+
+func resourceKoyebDomainVerification() *schema.Resource {
+	return &schema.Resource{
+		// This description is used by the documentation generator and the language server.
+		Description: "Domain verification resource in the Koyeb Terraform provider. It waits for a domain to be verified and become active, and creates no resource in Koyeb, so the DNS records of the domain can be created in the same apply before waiting for the verification.",
+
+		CreateContext: resourceKoyebDomainVerificationCreate,
+		ReadContext:   resourceKoyebDomainVerificationRead,
+		DeleteContext: resourceKoyebDomainVerificationDelete,
+
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(30 * time.Minute),
+		},
+
+		Schema: domainVerificationSchema(),
+	}
+}
+
+// domainVerificationWaiter waits for the domain to become active, and fails
+// with the messages of the domain when its verification fails.
+func domainVerificationWaiter(client *Client, id string) statusWaiter[koyeb.GetDomainReply] {
+	waiter := domainStatusWaiter(client, id)
+	waiter.Pending = []string{string(koyeb.DOMAINSTATUS_PENDING)}
+	waiter.Target = []string{string(koyeb.DOMAINSTATUS_ACTIVE)}
+	waiter.Failure = []string{string(koyeb.DOMAINSTATUS_ERROR)}
+
+	return waiter
+}
+
+func resourceKoyebDomainVerificationCreate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	client := meta.(*Client)
+
+	res, err := domainVerificationWaiter(client, d.Get("domain_id").(string)).Wait(ctx)
+	if err != nil {
+		return diag.Errorf("Error waiting for domain to be verified: %s", err)
+	}
+
+	d.SetId(res.Domain.GetId())
+	tflog.Info(ctx, "Verified domain", map[string]interface{}{"name": res.Domain.GetName(), "id": res.Domain.GetId()})
+
+	return resourceKoyebDomainVerificationRead(ctx, d, meta)
+}
+
+func resourceKoyebDomainVerificationRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	client := meta.(*Client)
+
+	res, resp, err := client.DomainsApi.GetDomain(ctx, d.Id()).Execute()
+	if err != nil {
+		// The verification goes along with the domain
+		if resp != nil && resp.StatusCode == 404 {
+			d.SetId("")
+			return nil
+		}
+
+		return apiErrorDiagnostics("Error retrieving domain", err, domainVerificationSchema())
+	}
+
+	d.Set("domain_id", res.Domain.GetId())
+	d.Set("status", res.Domain.GetStatus())
+	d.Set("verified_at", flattenTime(res.Domain.GetVerifiedAtOk()))
+
+	return nil
+}
+
+// resourceKoyebDomainVerificationDelete only removes the verification from
+// the state, the domain is left as is.
+func resourceKoyebDomainVerificationDelete(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	d.SetId("")
+	return nil
+}
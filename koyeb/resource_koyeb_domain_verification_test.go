@@ -0,0 +1,67 @@
+package koyeb
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/koyeb/koyeb-api-client-go/api/v1/koyeb"
+)
+
+func TestResourceKoyebDomainVerification(t *testing.T) {
+	ctx := context.Background()
+	api := newFakeAPI()
+	server := httptest.NewServer(api)
+	t.Cleanup(server.Close)
+
+	config := koyeb.NewConfiguration()
+	config.DefaultHeader["Authorization"] = "Bearer " + fakeAPIToken
+	if err := setAPIURL(config, server.URL); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	client := newClient(koyeb.NewAPIClient(config))
+
+	res, _, err := client.DomainsApi.CreateDomain(ctx).Body(koyeb.CreateDomain{Name: toOpt("example.com"), Type: toOpt(koyeb.DOMAINTYPE_CUSTOM)}).Execute()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	domainId := res.Domain.GetId()
+
+	d := schema.TestResourceDataRaw(t, resourceKoyebDomainVerification().Schema, map[string]interface{}{"domain_id": domainId})
+
+	// The DNS record isn't created yet, the domain stays pending
+	timeoutCtx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	if diags := resourceKoyebDomainVerificationCreate(timeoutCtx, d, client); !diags.HasError() {
+		t.Fatal("expected an error while the domain is pending")
+	}
+
+	api.resolve("example.com")
+
+	if diags := resourceKoyebDomainVerificationCreate(ctx, d, client); diags.HasError() {
+		t.Fatalf("unexpected error: %v", diags)
+	}
+	if d.Id() != domainId || d.Get("status").(string) != string(koyeb.DOMAINSTATUS_ACTIVE) || d.Get("verified_at").(string) == "" {
+		t.Errorf("expected the verified domain, got id %s, status %s, verified_at %s", d.Id(), d.Get("status"), d.Get("verified_at"))
+	}
+
+	if diags := resourceKoyebDomainVerificationDelete(ctx, d, client); diags.HasError() {
+		t.Fatalf("unexpected error: %v", diags)
+	}
+	if _, _, err := client.DomainsApi.GetDomain(ctx, domainId).Execute(); err != nil {
+		t.Errorf("expected the domain to be kept, got %s", err)
+	}
+
+	if _, _, err := client.DomainsApi.DeleteDomain(ctx, domainId).Execute(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	d.SetId(domainId)
+	if diags := resourceKoyebDomainVerificationRead(ctx, d, client); diags.HasError() {
+		t.Fatalf("unexpected error: %v", diags)
+	}
+	if d.Id() != "" {
+		t.Errorf("expected the verification to be removed from the state with its domain")
+	}
+}
@@ -2,12 +2,16 @@ package koyeb
 
 import (
 	"context"
-	"log"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"sort"
 
-	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
 	"github.com/koyeb/koyeb-api-client-go/api/v1/koyeb"
+	"golang.org/x/exp/slices"
 )
 
 func gitHubRegistrySchema() *schema.Resource {
@@ -28,17 +32,6 @@ func gitHubRegistrySchema() *schema.Resource {
 	}
 }
 
-func expandGitHubRegistry(config []interface{}) *koyeb.GitHubRegistryConfiguration {
-	rawGitHubRegistry := config[0].(map[string]interface{})
-
-	gitHubRegistry := &koyeb.GitHubRegistryConfiguration{
-		Username: toOpt(rawGitHubRegistry["username"].(string)),
-		Password: toOpt(rawGitHubRegistry["password"].(string)),
-	}
-
-	return gitHubRegistry
-}
-
 func flattenGitHubRegistry(gitHubRegistry *koyeb.GitHubRegistryConfiguration) []interface{} {
 	result := make([]interface{}, 0)
 
@@ -69,17 +62,6 @@ func gitLabRegistrySchema() *schema.Resource {
 	}
 }
 
-func expandGitLabRegistry(config []interface{}) *koyeb.GitLabRegistryConfiguration {
-	rawGitLabRegistry := config[0].(map[string]interface{})
-
-	gitLabRegistry := &koyeb.GitLabRegistryConfiguration{
-		Username: toOpt(rawGitLabRegistry["username"].(string)),
-		Password: toOpt(rawGitLabRegistry["password"].(string)),
-	}
-
-	return gitLabRegistry
-}
-
 func flattenGitLabRegistry(gitLabRegistry *koyeb.GitLabRegistryConfiguration) []interface{} {
 	result := make([]interface{}, 0)
 
@@ -110,17 +92,6 @@ func digitalOceanRegistrySchema() *schema.Resource {
 	}
 }
 
-func expandDigitalOceanRegistry(config []interface{}) *koyeb.DigitalOceanRegistryConfiguration {
-	rawDigitalOceanRegistry := config[0].(map[string]interface{})
-
-	digitalOceanRegistry := &koyeb.DigitalOceanRegistryConfiguration{
-		Username: toOpt(rawDigitalOceanRegistry["username"].(string)),
-		Password: toOpt(rawDigitalOceanRegistry["password"].(string)),
-	}
-
-	return digitalOceanRegistry
-}
-
 func flattenDigitalOceanRegistry(digitalOceanRegistry *koyeb.DigitalOceanRegistryConfiguration) []interface{} {
 	result := make([]interface{}, 0)
 
@@ -151,17 +122,6 @@ func dockerHubRegistrySchema() *schema.Resource {
 	}
 }
 
-func expandDockerHubRegistry(config []interface{}) *koyeb.DockerHubRegistryConfiguration {
-	rawDockerHubRegistry := config[0].(map[string]interface{})
-
-	dockerHubRegistry := &koyeb.DockerHubRegistryConfiguration{
-		Username: toOpt(rawDockerHubRegistry["username"].(string)),
-		Password: toOpt(rawDockerHubRegistry["password"].(string)),
-	}
-
-	return dockerHubRegistry
-}
-
 func flattenDockerHubRegistry(dockerHubRegistry *koyeb.DockerHubRegistryConfiguration) []interface{} {
 	result := make([]interface{}, 0)
 
@@ -198,18 +158,6 @@ func privateRegistrySchema() *schema.Resource {
 	}
 }
 
-func expandPrivateRegistry(config []interface{}) *koyeb.PrivateRegistryConfiguration {
-	rawPrivateRegistry := config[0].(map[string]interface{})
-
-	dockerHubRegistry := &koyeb.PrivateRegistryConfiguration{
-		Username: toOpt(rawPrivateRegistry["username"].(string)),
-		Password: toOpt(rawPrivateRegistry["password"].(string)),
-		Url:      toOpt(rawPrivateRegistry["url"].(string)),
-	}
-
-	return dockerHubRegistry
-}
-
 func flattenPrivateRegistry(privateRegistry *koyeb.PrivateRegistryConfiguration) []interface{} {
 	result := make([]interface{}, 0)
 
@@ -246,18 +194,6 @@ func azureRegistrySchema() *schema.Resource {
 	}
 }
 
-func expandAzureContainerRegistry(config []interface{}) *koyeb.AzureContainerRegistryConfiguration {
-	rawAzureContainerRegistry := config[0].(map[string]interface{})
-
-	azureContainerRegistry := &koyeb.AzureContainerRegistryConfiguration{
-		Username:     toOpt(rawAzureContainerRegistry["username"].(string)),
-		Password:     toOpt(rawAzureContainerRegistry["password"].(string)),
-		RegistryName: toOpt(rawAzureContainerRegistry["registry_name"].(string)),
-	}
-
-	return azureContainerRegistry
-}
-
 func flattenAzureContainerRegistry(azureContainerRegistry *koyeb.AzureContainerRegistryConfiguration) []interface{} {
 	result := make([]interface{}, 0)
 
@@ -271,6 +207,150 @@ func flattenAzureContainerRegistry(azureContainerRegistry *koyeb.AzureContainerR
 	return result
 }
 
+const (
+	secretGenerateLowerChars   = "abcdefghijklmnopqrstuvwxyz"
+	secretGenerateUpperChars   = "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	secretGenerateNumericChars = "0123456789"
+	secretGenerateSpecialChars = "!@#$%&*()-_=+[]{}<>:?"
+)
+
+func secretGenerateSchema() *schema.Resource {
+	return &schema.Resource{
+		Schema: map[string]*schema.Schema{
+			"length": {
+				Type:         schema.TypeInt,
+				Optional:     true,
+				Default:      32,
+				Description:  "The length of the generated secret value",
+				ValidateFunc: validation.IntBetween(8, 1024),
+			},
+			"lower": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     true,
+				Description: "Include lowercase alphabet characters in the generated secret value",
+			},
+			"upper": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     true,
+				Description: "Include uppercase alphabet characters in the generated secret value",
+			},
+			"numeric": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     true,
+				Description: "Include numeric characters in the generated secret value",
+			},
+			"special": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     true,
+				Description: "Include special characters in the generated secret value",
+			},
+			"override_special": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "The special characters to use instead of the default set when `special` is enabled",
+			},
+		},
+	}
+}
+
+// secretGenerateClasses returns the character classes enabled by the
+// generate block.
+func secretGenerateClasses(lower, upper, numeric, special bool, overrideSpecial string) []string {
+	classes := []string{}
+
+	if lower {
+		classes = append(classes, secretGenerateLowerChars)
+	}
+	if upper {
+		classes = append(classes, secretGenerateUpperChars)
+	}
+	if numeric {
+		classes = append(classes, secretGenerateNumericChars)
+	}
+	if special {
+		if overrideSpecial != "" {
+			classes = append(classes, overrideSpecial)
+		} else {
+			classes = append(classes, secretGenerateSpecialChars)
+		}
+	}
+
+	return classes
+}
+
+// generateSecretValue returns a random string of the given length containing
+// at least one character of each of the given classes. The classes are drawn
+// from by character, so they may hold multibyte characters.
+func generateSecretValue(length int, classes []string) (string, error) {
+	if len(classes) == 0 {
+		return "", fmt.Errorf("at least one character class must be enabled to generate a secret value")
+	}
+	if length < len(classes) {
+		return "", fmt.Errorf("length %d is too short to include every enabled character class", length)
+	}
+
+	charset := []rune{}
+	for _, c := range classes {
+		charset = append(charset, []rune(c)...)
+	}
+
+	value := make([]rune, 0, length)
+	for _, c := range classes {
+		r, err := randomChar([]rune(c))
+		if err != nil {
+			return "", err
+		}
+		value = append(value, r)
+	}
+	for len(value) < length {
+		r, err := randomChar(charset)
+		if err != nil {
+			return "", err
+		}
+		value = append(value, r)
+	}
+
+	// Shuffle so the guaranteed characters are not always at the start
+	for i := len(value) - 1; i > 0; i-- {
+		j, err := rand.Int(rand.Reader, big.NewInt(int64(i+1)))
+		if err != nil {
+			return "", err
+		}
+		value[i], value[j.Int64()] = value[j.Int64()], value[i]
+	}
+
+	return string(value), nil
+}
+
+func randomChar(charset []rune) (rune, error) {
+	if len(charset) == 0 {
+		return 0, fmt.Errorf("cannot pick a character from an empty character class")
+	}
+
+	n, err := rand.Int(rand.Reader, big.NewInt(int64(len(charset))))
+	if err != nil {
+		return 0, err
+	}
+
+	return charset[n.Int64()], nil
+}
+
+// newSecretKeeperHash returns a random identifier of a generated secret value.
+// It is not derived from the value, which a hash of a short value would leak
+// to anyone reading the state.
+func newSecretKeeperHash() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(id), nil
+}
+
 func secretSchema() map[string]*schema.Schema {
 	secret := map[string]*schema.Schema{
 		"id": {
@@ -307,6 +387,7 @@ func secretSchema() map[string]*schema.Schema {
 			Description: "The secret value",
 			Sensitive:   true,
 			ConflictsWith: []string{
+				"generate",
 				"docker_hub_registry",
 				"azure_container_registry",
 				"github_registry",
@@ -315,6 +396,34 @@ func secretSchema() map[string]*schema.Schema {
 				"digital_ocean_container_registry",
 			},
 		},
+		"generate": {
+			Type:        schema.TypeSet,
+			Optional:    true,
+			Elem:        secretGenerateSchema(),
+			Description: "Generate the secret value in the provider instead of passing it through `value`. The generated value is never stored in the state",
+			MaxItems:    1,
+			ConflictsWith: []string{
+				"value",
+				"docker_hub_registry",
+				"azure_container_registry",
+				"github_registry",
+				"gitlab_registry",
+				"private_registry",
+				"digital_ocean_container_registry",
+			},
+			Set: schema.HashResource(secretGenerateSchema()),
+		},
+		"rotation_trigger": {
+			Type:         schema.TypeString,
+			Optional:     true,
+			Description:  "An arbitrary value that regenerates the secret value when changed",
+			RequiredWith: []string{"generate"},
+		},
+		"keeper_hash": {
+			Type:        schema.TypeString,
+			Computed:    true,
+			Description: "A random identifier of the generated secret value, which changes when the value is regenerated",
+		},
 		"docker_hub_registry": {
 			Type:        schema.TypeSet,
 			Optional:    true,
@@ -405,6 +514,18 @@ func secretSchema() map[string]*schema.Schema {
 			},
 			Set: schema.HashResource(privateRegistrySchema()),
 		},
+		"used_by": {
+			Type:        schema.TypeList,
+			Computed:    true,
+			Description: "The slugs of the services whose latest deployment references the secret. Computing it lists every service of the organization and fetches its latest deployment, once per Terraform run, which can be slow on large organizations",
+			Elem:        &schema.Schema{Type: schema.TypeString},
+		},
+		"prevent_destroy_if_used": {
+			Type:        schema.TypeBool,
+			Optional:    true,
+			Default:     false,
+			Description: "Refuse to delete the secret while services still reference it",
+		},
 		"updated_at": {
 			Type:        schema.TypeString,
 			Computed:    true,
@@ -420,20 +541,6 @@ func secretSchema() map[string]*schema.Schema {
 	return secret
 }
 
-func resourceKoyebSecret() *schema.Resource {
-	return &schema.Resource{
-		// This description is used by the documentation generator and the language server.
-		Description: "Secret resource in the Koyeb Terraform provider.",
-
-		CreateContext: resourceKoyebSecretCreate,
-		ReadContext:   resourceKoyebSecretRead,
-		UpdateContext: resourceKoyebSecretUpdate,
-		DeleteContext: resourceKoyebSecretDelete,
-
-		Schema: secretSchema(),
-	}
-}
-
 func setSecretAttribute(d *schema.ResourceData, secret koyeb.Secret) error {
 	d.SetId(secret.GetId())
 	d.Set("name", secret.GetName())
@@ -446,134 +553,99 @@ func setSecretAttribute(d *schema.ResourceData, secret koyeb.Secret) error {
 	// d.Set("private_registry", flattenPrivateRegistry(secret.PrivateRegistry))
 	// d.Set("azure_container_registry", flattenAzureContainerRegistry(secret.AzureContainerRegistry))
 	d.Set("organization_id", secret.GetOrganizationId())
-	d.Set("created_at", secret.GetCreatedAt().UTC().String())
-	d.Set("updated_at", secret.GetUpdatedAt().UTC().String())
+	d.Set("created_at", flattenTime(secret.GetCreatedAtOk()))
+	d.Set("updated_at", flattenTime(secret.GetUpdatedAtOk()))
 
 	return nil
 }
 
-func resourceKoyebSecretCreate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
-	client := meta.(*koyeb.APIClient)
-
-	secret := koyeb.CreateSecret{
-		Name: toOpt(d.Get("name").(string)),
-		Type: toOpt(koyeb.SecretType(d.Get("type").(string))),
-	}
-
-	if value, ok := d.GetOk("value"); ok {
-		secret.Value = toOpt(value.(string))
-	}
-
-	if dockerHubRegistry, ok := d.GetOk("docker_hub_registry"); ok && dockerHubRegistry.(*schema.Set).Len() > 0 && dockerHubRegistry.(*schema.Set).List()[0] != nil {
-		secret.DockerHubRegistry = expandDockerHubRegistry(d.Get("docker_hub_registry").(*schema.Set).List())
-	}
-
-	if gitHubRegistry, ok := d.GetOk("github_registry"); ok && gitHubRegistry.(*schema.Set).Len() > 0 && gitHubRegistry.(*schema.Set).List()[0] != nil {
-		secret.GithubRegistry = expandGitHubRegistry(d.Get("github_registry").(*schema.Set).List())
+// deploymentDefinitionSecrets returns the names of the secrets a deployment
+// definition references, either in its environment or as registry credentials.
+func deploymentDefinitionSecrets(definition *koyeb.DeploymentDefinition) []string {
+	secrets := []string{}
+	if definition == nil {
+		return secrets
 	}
 
-	if doRegistry, ok := d.GetOk("digital_ocean_container_registry"); ok && doRegistry.(*schema.Set).Len() > 0 && doRegistry.(*schema.Set).List()[0] != nil {
-		secret.DigitalOceanRegistry = expandDigitalOceanRegistry(d.Get("digital_ocean_container_registry").(*schema.Set).List())
-	}
-
-	if gitLabRegistry, ok := d.GetOk("gitlab_registry"); ok && gitLabRegistry.(*schema.Set).Len() > 0 && gitLabRegistry.(*schema.Set).List()[0] != nil {
-		secret.GitlabRegistry = expandGitLabRegistry(d.Get("gitlab_registry").(*schema.Set).List())
-	}
-
-	if privateRegistry, ok := d.GetOk("private_registry"); ok && privateRegistry.(*schema.Set).Len() > 0 && privateRegistry.(*schema.Set).List()[0] != nil {
-		secret.PrivateRegistry = expandPrivateRegistry(d.Get("private_registry").(*schema.Set).List())
-	}
-
-	if azureContainerRegistry, ok := d.GetOk("azure_container_registry"); ok && azureContainerRegistry.(*schema.Set).Len() > 0 && azureContainerRegistry.(*schema.Set).List()[0] != nil {
-		secret.AzureContainerRegistry = expandAzureContainerRegistry(d.Get("azure_container_registry").(*schema.Set).List())
+	for _, env := range definition.GetEnv() {
+		if env.GetSecret() != "" {
+			secrets = append(secrets, env.GetSecret())
+		}
 	}
 
-	res, resp, err := client.SecretsApi.CreateSecret(ctx).Body(secret).Execute()
-	if err != nil {
-		return diag.Errorf("Error creating secret: %s (%v %v)", err, resp, res)
+	if docker, ok := definition.GetDockerOk(); ok && docker.GetImageRegistrySecret() != "" {
+		secrets = append(secrets, docker.GetImageRegistrySecret())
 	}
 
-	d.SetId(*res.Secret.Id)
-	log.Printf("[INFO] Created secret name: %s", *res.Secret.Name)
-
-	return resourceKoyebSecretRead(ctx, d, meta)
+	return secrets
 }
 
-func resourceKoyebSecretRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
-	client := meta.(*koyeb.APIClient)
-
-	res, resp, err := client.SecretsApi.GetSecret(context.Background(), d.Id()).Execute()
+// secretUsedBy returns the slugs of the services whose latest deployment
+// references the secret. The services are only listed once per provider
+// instance, see secretUsageCache.
+func secretUsedBy(ctx context.Context, client *Client, secretName string) ([]string, error) {
+	usage, err := client.secretUsage.get(func() (map[string][]string, error) {
+		return listSecretUsage(ctx, client)
+	})
 	if err != nil {
-		// If the Secret is somehow already destroyed, mark as
-		// successfully gone
-		if resp.StatusCode == 404 {
-			d.SetId("")
-			return nil
-		}
-
-		return diag.Errorf("Error retrieving secret: %s (%v %v)", err, resp, res)
+		return nil, err
 	}
 
-	setSecretAttribute(d, *res.Secret)
-
-	return nil
+	return append([]string{}, usage[secretName]...), nil
 }
 
-func resourceKoyebSecretUpdate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
-	client := meta.(*koyeb.APIClient)
-
-	secret := koyeb.Secret{
-		Name: toOpt(d.Get("name").(string)),
-		Type: toOpt(koyeb.SecretType(d.Get("type").(string))),
-	}
-
-	if value, ok := d.GetOk("value"); ok {
-		secret.Value = toOpt(value.(string))
+// listSecretUsage returns the slugs of the services whose latest deployment
+// references each secret, indexed by secret name.
+func listSecretUsage(ctx context.Context, client *Client) (map[string][]string, error) {
+	services, err := client.ListServices(ctx, "")
+	if err != nil {
+		return nil, err
 	}
 
-	if dockerHubRegistry, ok := d.GetOk("docker_hub_registry"); ok && dockerHubRegistry.(*schema.Set).Len() > 0 && dockerHubRegistry.(*schema.Set).List()[0] != nil {
-		secret.DockerHubRegistry = expandDockerHubRegistry(dockerHubRegistry.(*schema.Set).List())
-	}
+	appNames := map[string]string{}
+	usage := map[string][]string{}
 
-	if gitHubRegistry, ok := d.GetOk("github_registry"); ok && gitHubRegistry.(*schema.Set).Len() > 0 && gitHubRegistry.(*schema.Set).List()[0] != nil {
-		secret.GithubRegistry = expandGitHubRegistry(gitHubRegistry.(*schema.Set).List())
-	}
+	for _, svc := range services {
+		if svc.GetStatus() == koyeb.SERVICESTATUS_DELETING || svc.GetStatus() == koyeb.SERVICESTATUS_DELETED {
+			continue
+		}
 
-	if doRegistry, ok := d.GetOk("digital_ocean_container_registry"); ok && doRegistry.(*schema.Set).Len() > 0 && doRegistry.(*schema.Set).List()[0] != nil {
-		secret.DigitalOceanRegistry = expandDigitalOceanRegistry(doRegistry.(*schema.Set).List())
-	}
+		deploymentId := svc.GetLatestDeploymentId()
+		if deploymentId == "" {
+			continue
+		}
 
-	if gitLabRegistry, ok := d.GetOk("gitlab_registry"); ok && gitLabRegistry.(*schema.Set).Len() > 0 && gitLabRegistry.(*schema.Set).List()[0] != nil {
-		secret.GitlabRegistry = expandGitLabRegistry(gitLabRegistry.(*schema.Set).List())
-	}
+		res, _, err := client.DeploymentsApi.GetDeployment(ctx, deploymentId).Execute()
+		if err != nil {
+			return nil, err
+		}
 
-	if privateRegistry, ok := d.GetOk("private_registry"); ok && privateRegistry.(*schema.Set).Len() > 0 && privateRegistry.(*schema.Set).List()[0] != nil {
-		secret.PrivateRegistry = expandPrivateRegistry(privateRegistry.(*schema.Set).List())
-	}
+		secrets := deploymentDefinitionSecrets(res.Deployment.Definition)
+		if len(secrets) == 0 {
+			continue
+		}
 
-	if azureContainerRegistry, ok := d.GetOk("azure_container_registry"); ok && azureContainerRegistry.(*schema.Set).Len() > 0 && azureContainerRegistry.(*schema.Set).List()[0] != nil {
-		secret.AzureContainerRegistry = expandAzureContainerRegistry(azureContainerRegistry.(*schema.Set).List())
-	}
+		appName, ok := appNames[svc.GetAppId()]
+		if !ok {
+			appName, err = client.AppName(ctx, svc.GetAppId())
+			if err != nil {
+				return nil, err
+			}
 
-	res, resp, err := client.SecretsApi.UpdateSecret(context.Background(), d.Id()).Body(secret).Execute()
+			appNames[svc.GetAppId()] = appName
+		}
 
-	if err != nil {
-		return diag.Errorf("Error updating secret: %s (%v %v)", err, resp, res)
+		slug := serviceSlug(appName, svc.GetName())
+		for _, secret := range secrets {
+			if !slices.Contains(usage[secret], slug) {
+				usage[secret] = append(usage[secret], slug)
+			}
+		}
 	}
 
-	log.Printf("[INFO] Updated secret name: %s", *res.Secret.Name)
-	return resourceKoyebSecretRead(ctx, d, meta)
-}
-
-func resourceKoyebSecretDelete(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
-	client := meta.(*koyeb.APIClient)
-
-	res, resp, err := client.SecretsApi.DeleteSecret(context.Background(), d.Id()).Execute()
-
-	if err != nil {
-		return diag.Errorf("Error deleting secret: %s (%v %v)", err, resp, res)
+	for _, usedBy := range usage {
+		sort.Strings(usedBy)
 	}
 
-	d.SetId("")
-	return nil
+	return usage, nil
 }
@@ -0,0 +1,858 @@
+package koyeb
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-framework-validators/int64validator"
+	"github.com/hashicorp/terraform-plugin-framework-validators/setvalidator"
+	"github.com/hashicorp/terraform-plugin-framework-validators/stringvalidator"
+	"github.com/hashicorp/terraform-plugin-framework/attr"
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/hashicorp/terraform-plugin-framework/resource"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/booldefault"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/int64default"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/listplanmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/planmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/stringdefault"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/stringplanmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/schema/validator"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+	"github.com/koyeb/koyeb-api-client-go/api/v1/koyeb"
+)
+
+// secretResource is the koyeb_secret resource. It is the first resource
+// served by the plugin framework, its schema and state are the ones of the
+// SDK implementation it replaces.
+type secretResource struct {
+	client *Client
+}
+
+var (
+	_ resource.Resource                   = &secretResource{}
+	_ resource.ResourceWithConfigure      = &secretResource{}
+	_ resource.ResourceWithValidateConfig = &secretResource{}
+	_ resource.ResourceWithModifyPlan     = &secretResource{}
+	_ resource.ResourceWithUpgradeState   = &secretResource{}
+)
+
+func newSecretResource() resource.Resource {
+	return &secretResource{}
+}
+
+type secretResourceModel struct {
+	ID                            types.String `tfsdk:"id"`
+	Name                          types.String `tfsdk:"name"`
+	OrganizationID                types.String `tfsdk:"organization_id"`
+	Type                          types.String `tfsdk:"type"`
+	Value                         types.String `tfsdk:"value"`
+	Generate                      types.Set    `tfsdk:"generate"`
+	RotationTrigger               types.String `tfsdk:"rotation_trigger"`
+	KeeperHash                    types.String `tfsdk:"keeper_hash"`
+	DockerHubRegistry             types.Set    `tfsdk:"docker_hub_registry"`
+	GitHubRegistry                types.Set    `tfsdk:"github_registry"`
+	GitLabRegistry                types.Set    `tfsdk:"gitlab_registry"`
+	DigitalOceanContainerRegistry types.Set    `tfsdk:"digital_ocean_container_registry"`
+	PrivateRegistry               types.Set    `tfsdk:"private_registry"`
+	AzureContainerRegistry        types.Set    `tfsdk:"azure_container_registry"`
+	UsedBy                        types.List   `tfsdk:"used_by"`
+	PreventDestroyIfUsed          types.Bool   `tfsdk:"prevent_destroy_if_used"`
+	UpdatedAt                     types.String `tfsdk:"updated_at"`
+	CreatedAt                     types.String `tfsdk:"created_at"`
+}
+
+type secretGenerateModel struct {
+	Length          types.Int64  `tfsdk:"length"`
+	Lower           types.Bool   `tfsdk:"lower"`
+	Upper           types.Bool   `tfsdk:"upper"`
+	Numeric         types.Bool   `tfsdk:"numeric"`
+	Special         types.Bool   `tfsdk:"special"`
+	OverrideSpecial types.String `tfsdk:"override_special"`
+}
+
+type registryModel struct {
+	Username types.String `tfsdk:"username"`
+	Password types.String `tfsdk:"password"`
+}
+
+type privateRegistryModel struct {
+	Username types.String `tfsdk:"username"`
+	Password types.String `tfsdk:"password"`
+	URL      types.String `tfsdk:"url"`
+}
+
+type azureRegistryModel struct {
+	Username     types.String `tfsdk:"username"`
+	Password     types.String `tfsdk:"password"`
+	RegistryName types.String `tfsdk:"registry_name"`
+}
+
+// secretValueSources are the mutually exclusive ways of setting the value of
+// a secret.
+var secretValueSources = []string{
+	"value",
+	"generate",
+	"docker_hub_registry",
+	"github_registry",
+	"gitlab_registry",
+	"digital_ocean_container_registry",
+	"private_registry",
+	"azure_container_registry",
+}
+
+func (r *secretResource) Metadata(ctx context.Context, req resource.MetadataRequest, resp *resource.MetadataResponse) {
+	resp.TypeName = req.ProviderTypeName + "_secret"
+}
+
+func registryBlock(description string, attributes map[string]schema.Attribute) schema.SetNestedBlock {
+	attributes["username"] = schema.StringAttribute{
+		MarkdownDescription: "The registry username",
+		Required:            true,
+	}
+	attributes["password"] = schema.StringAttribute{
+		MarkdownDescription: "The registry password",
+		Required:            true,
+		Sensitive:           true,
+	}
+
+	return schema.SetNestedBlock{
+		MarkdownDescription: description,
+		NestedObject:        schema.NestedBlockObject{Attributes: attributes},
+		Validators:          []validator.Set{setvalidator.SizeAtMost(1)},
+	}
+}
+
+func (r *secretResource) Schema(ctx context.Context, req resource.SchemaRequest, resp *resource.SchemaResponse) {
+	resp.Schema = schema.Schema{
+		// This description is used by the documentation generator and the language server.
+		MarkdownDescription: "Secret resource in the Koyeb Terraform provider.",
+
+		Version: 3,
+
+		Attributes: map[string]schema.Attribute{
+			"id": schema.StringAttribute{
+				Computed:            true,
+				MarkdownDescription: "The secret ID",
+				PlanModifiers:       []planmodifier.String{stringplanmodifier.UseStateForUnknown()},
+			},
+			"name": schema.StringAttribute{
+				Required:            true,
+				MarkdownDescription: "The secret name",
+				PlanModifiers:       []planmodifier.String{stringplanmodifier.RequiresReplace()},
+				Validators:          []validator.String{stringvalidator.LengthBetween(2, 64)},
+			},
+			"organization_id": schema.StringAttribute{
+				Computed:            true,
+				MarkdownDescription: "The organization ID owning the secret",
+				PlanModifiers:       []planmodifier.String{stringplanmodifier.UseStateForUnknown()},
+			},
+			"type": schema.StringAttribute{
+				Optional:            true,
+				Computed:            true,
+				Default:             stringdefault.StaticString(string(koyeb.SECRETTYPE_SIMPLE)),
+				MarkdownDescription: "The secret type",
+				PlanModifiers:       []planmodifier.String{stringplanmodifier.RequiresReplace()},
+				Validators: []validator.String{stringvalidator.OneOf(
+					string(koyeb.SECRETTYPE_SIMPLE),
+					string(koyeb.SECRETTYPE_REGISTRY),
+				)},
+			},
+			"value": schema.StringAttribute{
+				Optional:            true,
+				Sensitive:           true,
+				MarkdownDescription: "The secret value",
+			},
+			"rotation_trigger": schema.StringAttribute{
+				Optional:            true,
+				MarkdownDescription: "An arbitrary value that regenerates the secret value when changed",
+			},
+			"keeper_hash": schema.StringAttribute{
+				Computed:            true,
+				MarkdownDescription: "A random identifier of the generated secret value, which changes when the value is regenerated",
+			},
+			"used_by": schema.ListAttribute{
+				Computed:            true,
+				ElementType:         types.StringType,
+				MarkdownDescription: "The slugs of the services whose latest deployment references the secret. Computing it lists every service of the organization and fetches its latest deployment, once per Terraform run, which can be slow on large organizations",
+				PlanModifiers:       []planmodifier.List{listplanmodifier.UseStateForUnknown()},
+			},
+			"prevent_destroy_if_used": schema.BoolAttribute{
+				Optional:            true,
+				Computed:            true,
+				Default:             booldefault.StaticBool(false),
+				MarkdownDescription: "Refuse to delete the secret while services still reference it",
+			},
+			"updated_at": schema.StringAttribute{
+				Computed:            true,
+				MarkdownDescription: "The date and time of when the secret was last updated",
+			},
+			"created_at": schema.StringAttribute{
+				Computed:            true,
+				MarkdownDescription: "The date and time of when the secret was created",
+				PlanModifiers:       []planmodifier.String{stringplanmodifier.UseStateForUnknown()},
+			},
+		},
+
+		Blocks: map[string]schema.Block{
+			"generate": schema.SetNestedBlock{
+				MarkdownDescription: "Generate the secret value in the provider instead of passing it through `value`. The generated value is never stored in the state",
+				Validators:          []validator.Set{setvalidator.SizeAtMost(1)},
+				NestedObject: schema.NestedBlockObject{
+					Attributes: map[string]schema.Attribute{
+						"length": schema.Int64Attribute{
+							Optional:            true,
+							Computed:            true,
+							Default:             int64default.StaticInt64(32),
+							MarkdownDescription: "The length of the generated secret value",
+							Validators:          []validator.Int64{int64validator.Between(8, 1024)},
+						},
+						"lower": schema.BoolAttribute{
+							Optional:            true,
+							Computed:            true,
+							Default:             booldefault.StaticBool(true),
+							MarkdownDescription: "Include lowercase alphabet characters in the generated secret value",
+						},
+						"upper": schema.BoolAttribute{
+							Optional:            true,
+							Computed:            true,
+							Default:             booldefault.StaticBool(true),
+							MarkdownDescription: "Include uppercase alphabet characters in the generated secret value",
+						},
+						"numeric": schema.BoolAttribute{
+							Optional:            true,
+							Computed:            true,
+							Default:             booldefault.StaticBool(true),
+							MarkdownDescription: "Include numeric characters in the generated secret value",
+						},
+						"special": schema.BoolAttribute{
+							Optional:            true,
+							Computed:            true,
+							Default:             booldefault.StaticBool(true),
+							MarkdownDescription: "Include special characters in the generated secret value",
+						},
+						"override_special": schema.StringAttribute{
+							Optional:            true,
+							MarkdownDescription: "The special characters to use instead of the default set when `special` is enabled",
+						},
+					},
+				},
+			},
+			"docker_hub_registry":              registryBlock("The DockerHub registry configuration to use", map[string]schema.Attribute{}),
+			"github_registry":                  registryBlock("The GitHub registry configuration to use", map[string]schema.Attribute{}),
+			"gitlab_registry":                  registryBlock("The GitLab registry configuration to use", map[string]schema.Attribute{}),
+			"digital_ocean_container_registry": registryBlock("The DigitalOcean registry configuration to use", map[string]schema.Attribute{}),
+			"private_registry": registryBlock("The DigitalOcean registry configuration to use", map[string]schema.Attribute{
+				"url": schema.StringAttribute{
+					MarkdownDescription: "The registry url",
+					Required:            true,
+				},
+			}),
+			"azure_container_registry": registryBlock("The Azure registry configuration to use", map[string]schema.Attribute{
+				"registry_name": schema.StringAttribute{
+					MarkdownDescription: "The registry name",
+					Required:            true,
+				},
+			}),
+		},
+	}
+}
+
+func (r *secretResource) Configure(ctx context.Context, req resource.ConfigureRequest, resp *resource.ConfigureResponse) {
+	if req.ProviderData == nil {
+		return
+	}
+
+	client, ok := req.ProviderData.(*Client)
+	if !ok {
+		resp.Diagnostics.AddError("Error configuring secret resource", fmt.Sprintf("Unexpected provider data %T", req.ProviderData))
+		return
+	}
+
+	r.client = client
+}
+
+// ValidateConfig enforces the conflicts between the attributes. Absent blocks
+// are empty sets rather than null values, so the generic conflict validators
+// can't be used.
+func (r *secretResource) ValidateConfig(ctx context.Context, req resource.ValidateConfigRequest, resp *resource.ValidateConfigResponse) {
+	var config secretResourceModel
+	resp.Diagnostics.Append(req.Config.Get(ctx, &config)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	sources := map[string]bool{
+		"value":                            !config.Value.IsNull(),
+		"generate":                         isSetConfigured(config.Generate),
+		"docker_hub_registry":              isSetConfigured(config.DockerHubRegistry),
+		"github_registry":                  isSetConfigured(config.GitHubRegistry),
+		"gitlab_registry":                  isSetConfigured(config.GitLabRegistry),
+		"digital_ocean_container_registry": isSetConfigured(config.DigitalOceanContainerRegistry),
+		"private_registry":                 isSetConfigured(config.PrivateRegistry),
+		"azure_container_registry":         isSetConfigured(config.AzureContainerRegistry),
+	}
+
+	configured := []string{}
+	for _, source := range secretValueSources {
+		if sources[source] {
+			configured = append(configured, source)
+		}
+	}
+
+	for _, source := range configured[min(len(configured), 1):] {
+		resp.Diagnostics.AddAttributeError(
+			path.Root(source),
+			"Invalid Attribute Combination",
+			fmt.Sprintf("%q conflicts with %q", source, configured[0]),
+		)
+	}
+
+	if !config.RotationTrigger.IsNull() && !sources["generate"] && !config.Generate.IsUnknown() {
+		resp.Diagnostics.AddAttributeError(
+			path.Root("rotation_trigger"),
+			"Invalid Attribute Combination",
+			`"rotation_trigger" requires "generate" to be set`,
+		)
+	}
+}
+
+// isSetConfigured reports whether a block is set, unknown blocks are assumed
+// to be set.
+func isSetConfigured(set types.Set) bool {
+	return set.IsUnknown() || (!set.IsNull() && len(set.Elements()) > 0)
+}
+
+// ModifyPlan only plans a new keeper_hash when the secret value is going to be
+// regenerated.
+func (r *secretResource) ModifyPlan(ctx context.Context, req resource.ModifyPlanRequest, resp *resource.ModifyPlanResponse) {
+	if req.Plan.Raw.IsNull() {
+		return
+	}
+
+	var plan secretResourceModel
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &plan)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	keeperHash := types.StringUnknown()
+
+	if !isSetConfigured(plan.Generate) {
+		keeperHash = types.StringNull()
+	} else if !req.State.Raw.IsNull() {
+		var state secretResourceModel
+		resp.Diagnostics.Append(req.State.Get(ctx, &state)...)
+		if resp.Diagnostics.HasError() {
+			return
+		}
+
+		if plan.Generate.Equal(state.Generate) && plan.RotationTrigger.Equal(state.RotationTrigger) {
+			keeperHash = state.KeeperHash
+		}
+	}
+
+	resp.Diagnostics.Append(resp.Plan.SetAttribute(ctx, path.Root("keeper_hash"), keeperHash)...)
+}
+
+// expandSecret returns the secret described by the plan. The value is
+// generated, and the keeper_hash of the plan updated, when regenerate is set.
+func expandSecret(ctx context.Context, plan *secretResourceModel, regenerate bool) (koyeb.Secret, diag.Diagnostics) {
+	var diags diag.Diagnostics
+
+	secret := koyeb.Secret{
+		Name: toOpt(plan.Name.ValueString()),
+		Type: toOpt(koyeb.SecretType(plan.Type.ValueString())),
+	}
+
+	if plan.Value.ValueString() != "" {
+		secret.Value = toOpt(plan.Value.ValueString())
+	}
+
+	if isSetConfigured(plan.Generate) {
+		if plan.Type.ValueString() != string(koyeb.SECRETTYPE_SIMPLE) {
+			diags.AddAttributeError(path.Root("generate"), "Error generating secret value", "generate can only be used with SIMPLE secrets")
+			return secret, diags
+		}
+
+		if regenerate {
+			var generate []secretGenerateModel
+			diags.Append(plan.Generate.ElementsAs(ctx, &generate, false)...)
+			if diags.HasError() {
+				return secret, diags
+			}
+
+			g := generate[0]
+			classes := secretGenerateClasses(g.Lower.ValueBool(), g.Upper.ValueBool(), g.Numeric.ValueBool(), g.Special.ValueBool(), g.OverrideSpecial.ValueString())
+
+			value, err := generateSecretValue(int(g.Length.ValueInt64()), classes)
+			if err != nil {
+				diags.AddAttributeError(path.Root("generate"), "Error generating secret value", err.Error())
+				return secret, diags
+			}
+
+			keeperHash, err := newSecretKeeperHash()
+			if err != nil {
+				diags.AddAttributeError(path.Root("generate"), "Error generating secret value", err.Error())
+				return secret, diags
+			}
+
+			secret.Value = toOpt(value)
+			plan.KeeperHash = types.StringValue(keeperHash)
+		}
+	} else {
+		plan.KeeperHash = types.StringNull()
+	}
+
+	var registry []registryModel
+
+	if isSetConfigured(plan.DockerHubRegistry) {
+		diags.Append(plan.DockerHubRegistry.ElementsAs(ctx, &registry, false)...)
+		secret.DockerHubRegistry = &koyeb.DockerHubRegistryConfiguration{
+			Username: toOpt(registry[0].Username.ValueString()),
+			Password: toOpt(registry[0].Password.ValueString()),
+		}
+	}
+
+	if isSetConfigured(plan.GitHubRegistry) {
+		diags.Append(plan.GitHubRegistry.ElementsAs(ctx, &registry, false)...)
+		secret.GithubRegistry = &koyeb.GitHubRegistryConfiguration{
+			Username: toOpt(registry[0].Username.ValueString()),
+			Password: toOpt(registry[0].Password.ValueString()),
+		}
+	}
+
+	if isSetConfigured(plan.GitLabRegistry) {
+		diags.Append(plan.GitLabRegistry.ElementsAs(ctx, &registry, false)...)
+		secret.GitlabRegistry = &koyeb.GitLabRegistryConfiguration{
+			Username: toOpt(registry[0].Username.ValueString()),
+			Password: toOpt(registry[0].Password.ValueString()),
+		}
+	}
+
+	if isSetConfigured(plan.DigitalOceanContainerRegistry) {
+		diags.Append(plan.DigitalOceanContainerRegistry.ElementsAs(ctx, &registry, false)...)
+		secret.DigitalOceanRegistry = &koyeb.DigitalOceanRegistryConfiguration{
+			Username: toOpt(registry[0].Username.ValueString()),
+			Password: toOpt(registry[0].Password.ValueString()),
+		}
+	}
+
+	if isSetConfigured(plan.PrivateRegistry) {
+		var privateRegistry []privateRegistryModel
+		diags.Append(plan.PrivateRegistry.ElementsAs(ctx, &privateRegistry, false)...)
+		secret.PrivateRegistry = &koyeb.PrivateRegistryConfiguration{
+			Username: toOpt(privateRegistry[0].Username.ValueString()),
+			Password: toOpt(privateRegistry[0].Password.ValueString()),
+			Url:      toOpt(privateRegistry[0].URL.ValueString()),
+		}
+	}
+
+	if isSetConfigured(plan.AzureContainerRegistry) {
+		var azureRegistry []azureRegistryModel
+		diags.Append(plan.AzureContainerRegistry.ElementsAs(ctx, &azureRegistry, false)...)
+		secret.AzureContainerRegistry = &koyeb.AzureContainerRegistryConfiguration{
+			Username:     toOpt(azureRegistry[0].Username.ValueString()),
+			Password:     toOpt(azureRegistry[0].Password.ValueString()),
+			RegistryName: toOpt(azureRegistry[0].RegistryName.ValueString()),
+		}
+	}
+
+	return secret, diags
+}
+
+func (r *secretResource) Create(ctx context.Context, req resource.CreateRequest, resp *resource.CreateResponse) {
+	var plan secretResourceModel
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &plan)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	ctx = loggingContext(ctx, "koyeb_secret", "", "create")
+
+	secret, diags := expandSecret(ctx, &plan, true)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	res, _, err := r.client.SecretsApi.CreateSecret(ctx).Body(koyeb.CreateSecret{
+		Name:                   secret.Name,
+		Type:                   secret.Type,
+		Value:                  secret.Value,
+		DockerHubRegistry:      secret.DockerHubRegistry,
+		PrivateRegistry:        secret.PrivateRegistry,
+		DigitalOceanRegistry:   secret.DigitalOceanRegistry,
+		GithubRegistry:         secret.GithubRegistry,
+		GitlabRegistry:         secret.GitlabRegistry,
+		AzureContainerRegistry: secret.AzureContainerRegistry,
+	}).Execute()
+	if err != nil {
+		resp.Diagnostics.Append(frameworkDiagnostics(apiErrorDiagnostics("Error creating secret", err, secretSchema()))...)
+		return
+	}
+
+	plan.ID = types.StringValue(res.Secret.GetId())
+	tflog.Info(ctx, "Created secret", map[string]interface{}{"name": res.Secret.GetName(), "id": res.Secret.GetId()})
+	r.client.ids.set(idKindSecret, res.Secret.GetName(), res.Secret.GetId())
+
+	if _, diags := r.read(ctx, &plan); diags.HasError() {
+		// Keep the created secret in the state so it is not leaked
+		resp.Diagnostics.Append(diags...)
+		resp.Diagnostics.Append(resp.State.SetAttribute(ctx, path.Root("id"), plan.ID)...)
+		return
+	}
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, plan)...)
+}
+
+func (r *secretResource) Read(ctx context.Context, req resource.ReadRequest, resp *resource.ReadResponse) {
+	var state secretResourceModel
+	resp.Diagnostics.Append(req.State.Get(ctx, &state)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	ctx = loggingContext(ctx, "koyeb_secret", state.ID.ValueString(), "read")
+
+	found, diags := r.read(ctx, &state)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	// If the Secret is somehow already destroyed, mark as
+	// successfully gone
+	if !found {
+		resp.State.RemoveResource(ctx)
+		return
+	}
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, state)...)
+}
+
+// read refreshes the computed attributes of model. It reports false when the
+// secret doesn't exist anymore.
+func (r *secretResource) read(ctx context.Context, model *secretResourceModel) (bool, diag.Diagnostics) {
+	var diags diag.Diagnostics
+
+	res, resp, err := r.client.SecretsApi.GetSecret(ctx, model.ID.ValueString()).Execute()
+	if err != nil {
+		if resp != nil && resp.StatusCode == 404 {
+			return false, nil
+		}
+
+		diags.Append(frameworkDiagnostics(apiErrorDiagnostics("Error retrieving secret", err, secretSchema()))...)
+		return false, diags
+	}
+
+	secret := res.GetSecret()
+	model.ID = types.StringValue(secret.GetId())
+	model.Name = types.StringValue(secret.GetName())
+	model.Type = types.StringValue(string(secret.GetType()))
+	model.OrganizationID = types.StringValue(secret.GetOrganizationId())
+	model.CreatedAt = timeValue(secret.GetCreatedAtOk())
+	model.UpdatedAt = timeValue(secret.GetUpdatedAtOk())
+
+	usedBy, err := secretUsedBy(ctx, r.client, secret.GetName())
+	if err != nil {
+		diags.AddError("Error retrieving services using secret", err.Error())
+		return true, diags
+	}
+
+	model.UsedBy, _ = types.ListValueFrom(ctx, types.StringType, usedBy)
+
+	return true, diags
+}
+
+// secretResourceModelV0 is the state of the versions 0 to 2 of the resource,
+// as decoded with secretSchemaV0.
+type secretResourceModelV0 struct {
+	ID                            types.String `tfsdk:"id"`
+	Name                          types.String `tfsdk:"name"`
+	OrganizationID                types.String `tfsdk:"organization_id"`
+	Type                          types.String `tfsdk:"type"`
+	Value                         types.String `tfsdk:"value"`
+	Generate                      types.Set    `tfsdk:"generate"`
+	RotationTrigger               types.String `tfsdk:"rotation_trigger"`
+	KeeperHash                    types.String `tfsdk:"keeper_hash"`
+	DockerHubRegistry             types.Set    `tfsdk:"docker_hub_registry"`
+	GitHubRegistry                types.Set    `tfsdk:"github_registry"`
+	GitLabRegistry                types.Set    `tfsdk:"gitlab_registry"`
+	DigitalOceanContainerRegistry types.Set    `tfsdk:"digital_ocean_container_registry"`
+	PrivateRegistry               types.Set    `tfsdk:"private_registry"`
+	AzureContainerRegistry        types.Set    `tfsdk:"azure_container_registry"`
+	UsedBy                        types.List   `tfsdk:"used_by"`
+	PreventDestroyIfUsed          types.Bool   `tfsdk:"prevent_destroy_if_used"`
+	UpdatedAt                     types.String `tfsdk:"updated_at"`
+	CreatedAt                     types.String `tfsdk:"created_at"`
+}
+
+// secretSchemaV0 is the shape of the states written at the versions 0 to 2,
+// which only differ by the format of their values. Version 0 was written by
+// the SDK implementation of the resource, the attributes added since are read
+// as null values. It is a frozen copy, and must not be derived from the
+// current schema, whose changes would change it too.
+func secretSchemaV0() schema.Schema {
+	registry := func(attributes map[string]schema.Attribute) schema.SetNestedBlock {
+		attributes["username"] = schema.StringAttribute{Required: true}
+		attributes["password"] = schema.StringAttribute{Required: true, Sensitive: true}
+
+		return schema.SetNestedBlock{NestedObject: schema.NestedBlockObject{Attributes: attributes}}
+	}
+
+	return schema.Schema{
+		Attributes: map[string]schema.Attribute{
+			"id":                      schema.StringAttribute{Computed: true},
+			"name":                    schema.StringAttribute{Required: true},
+			"organization_id":         schema.StringAttribute{Computed: true},
+			"type":                    schema.StringAttribute{Optional: true, Computed: true},
+			"value":                   schema.StringAttribute{Optional: true, Sensitive: true},
+			"rotation_trigger":        schema.StringAttribute{Optional: true},
+			"keeper_hash":             schema.StringAttribute{Computed: true},
+			"used_by":                 schema.ListAttribute{Computed: true, ElementType: types.StringType},
+			"prevent_destroy_if_used": schema.BoolAttribute{Optional: true, Computed: true},
+			"updated_at":              schema.StringAttribute{Computed: true},
+			"created_at":              schema.StringAttribute{Computed: true},
+		},
+		Blocks: map[string]schema.Block{
+			"generate": schema.SetNestedBlock{
+				NestedObject: schema.NestedBlockObject{
+					Attributes: map[string]schema.Attribute{
+						"length":           schema.Int64Attribute{Optional: true, Computed: true},
+						"lower":            schema.BoolAttribute{Optional: true, Computed: true},
+						"upper":            schema.BoolAttribute{Optional: true, Computed: true},
+						"numeric":          schema.BoolAttribute{Optional: true, Computed: true},
+						"special":          schema.BoolAttribute{Optional: true, Computed: true},
+						"override_special": schema.StringAttribute{Optional: true},
+					},
+				},
+			},
+			"docker_hub_registry":              registry(map[string]schema.Attribute{}),
+			"github_registry":                  registry(map[string]schema.Attribute{}),
+			"gitlab_registry":                  registry(map[string]schema.Attribute{}),
+			"digital_ocean_container_registry": registry(map[string]schema.Attribute{}),
+			"private_registry":                 registry(map[string]schema.Attribute{"url": schema.StringAttribute{Required: true}}),
+			"azure_container_registry":         registry(map[string]schema.Attribute{"registry_name": schema.StringAttribute{Required: true}}),
+		},
+	}
+}
+
+// UpgradeState migrates the states of the previous versions of the resource,
+// which all have the shape of secretSchemaV0:
+//   - version 0 was written by the SDK implementation of the resource
+//   - version 1 holds timestamps formatted by time.Time.String
+//   - version 2 holds the SHA-256 hash of the generated value as keeper_hash
+func (r *secretResource) UpgradeState(ctx context.Context) map[int64]resource.StateUpgrader {
+	priorSchema := secretSchemaV0()
+
+	upgrader := func(version int64) resource.StateUpgrader {
+		return resource.StateUpgrader{
+			PriorSchema: &priorSchema,
+			StateUpgrader: func(ctx context.Context, req resource.UpgradeStateRequest, resp *resource.UpgradeStateResponse) {
+				upgradeSecretState(ctx, version, req, resp)
+			},
+		}
+	}
+
+	return map[int64]resource.StateUpgrader{
+		0: upgrader(0),
+		1: upgrader(1),
+		2: upgrader(2),
+	}
+}
+
+func upgradeSecretState(ctx context.Context, version int64, req resource.UpgradeStateRequest, resp *resource.UpgradeStateResponse) {
+	var prior secretResourceModelV0
+	resp.Diagnostics.Append(req.State.Get(ctx, &prior)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	state := secretResourceModel(prior)
+
+	// The SDK stored empty strings for the unset attributes and older states
+	// lack the attributes added since, they are normalized so the states it
+	// wrote show no diff
+	if version < 1 {
+		state.Value = nullIfEmpty(state.Value)
+		state.RotationTrigger = nullIfEmpty(state.RotationTrigger)
+		state.KeeperHash = nullIfEmpty(state.KeeperHash)
+		resp.Diagnostics.Append(normalizeSecretGenerate(ctx, &state)...)
+
+		if state.Type.IsNull() {
+			state.Type = types.StringValue(string(koyeb.SECRETTYPE_SIMPLE))
+		}
+		if state.PreventDestroyIfUsed.IsNull() {
+			state.PreventDestroyIfUsed = types.BoolValue(false)
+		}
+
+		// Absent blocks are empty sets
+		for _, block := range []*types.Set{
+			&state.Generate,
+			&state.DockerHubRegistry,
+			&state.GitHubRegistry,
+			&state.GitLabRegistry,
+			&state.DigitalOceanContainerRegistry,
+			&state.PrivateRegistry,
+			&state.AzureContainerRegistry,
+		} {
+			if block.IsNull() {
+				*block = types.SetValueMust(block.ElementType(ctx), []attr.Value{})
+			}
+		}
+	}
+
+	// created_at is kept from the state when planning, it must have the format
+	// of the refreshed value
+	if version < 2 {
+		state.CreatedAt = upgradeTimeValue(state.CreatedAt)
+		state.UpdatedAt = upgradeTimeValue(state.UpdatedAt)
+	}
+
+	// The unsalted hash of a short generated value can be reversed, it is
+	// replaced with a random identifier without regenerating the value
+	if version < 3 && !state.KeeperHash.IsNull() {
+		keeperHash, err := newSecretKeeperHash()
+		if err != nil {
+			resp.Diagnostics.AddError("Error upgrading secret state", err.Error())
+			return
+		}
+
+		state.KeeperHash = types.StringValue(keeperHash)
+	}
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, state)...)
+}
+
+func upgradeTimeValue(value types.String) types.String {
+	t, err := parseLegacyTime(value.ValueString())
+	if err != nil {
+		return value
+	}
+
+	return timeValue(&t, true)
+}
+
+func nullIfEmpty(value types.String) types.String {
+	if value.IsUnknown() || value.ValueString() == "" {
+		return types.StringNull()
+	}
+
+	return value
+}
+
+func normalizeSecretGenerate(ctx context.Context, model *secretResourceModel) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	if model.Generate.IsNull() || model.Generate.IsUnknown() {
+		return diags
+	}
+
+	var generate []secretGenerateModel
+	diags.Append(model.Generate.ElementsAs(ctx, &generate, false)...)
+	if diags.HasError() {
+		return diags
+	}
+
+	for i := range generate {
+		generate[i].OverrideSpecial = nullIfEmpty(generate[i].OverrideSpecial)
+	}
+
+	set, d := types.SetValueFrom(ctx, model.Generate.ElementType(ctx), generate)
+	diags.Append(d...)
+	if !diags.HasError() {
+		model.Generate = set
+	}
+
+	return diags
+}
+
+func (r *secretResource) Update(ctx context.Context, req resource.UpdateRequest, resp *resource.UpdateResponse) {
+	var plan, state secretResourceModel
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &plan)...)
+	resp.Diagnostics.Append(req.State.Get(ctx, &state)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	ctx = loggingContext(ctx, "koyeb_secret", state.ID.ValueString(), "update")
+
+	// The generated value is never kept in the state, so it is regenerated
+	// whenever the generation settings or the rotation trigger change.
+	regenerate := !plan.Generate.Equal(state.Generate) || !plan.RotationTrigger.Equal(state.RotationTrigger)
+	changed := regenerate ||
+		!plan.Value.Equal(state.Value) ||
+		!plan.DockerHubRegistry.Equal(state.DockerHubRegistry) ||
+		!plan.GitHubRegistry.Equal(state.GitHubRegistry) ||
+		!plan.GitLabRegistry.Equal(state.GitLabRegistry) ||
+		!plan.DigitalOceanContainerRegistry.Equal(state.DigitalOceanContainerRegistry) ||
+		!plan.PrivateRegistry.Equal(state.PrivateRegistry) ||
+		!plan.AzureContainerRegistry.Equal(state.AzureContainerRegistry)
+
+	plan.ID = state.ID
+	plan.KeeperHash = state.KeeperHash
+
+	if changed {
+		secret, diags := expandSecret(ctx, &plan, regenerate)
+		resp.Diagnostics.Append(diags...)
+		if resp.Diagnostics.HasError() {
+			return
+		}
+
+		res, _, err := r.client.SecretsApi.UpdateSecret(ctx, state.ID.ValueString()).Body(secret).Execute()
+		if err != nil {
+			resp.Diagnostics.Append(frameworkDiagnostics(apiErrorDiagnostics("Error updating secret", err, secretSchema()))...)
+			return
+		}
+
+		tflog.Info(ctx, "Updated secret", map[string]interface{}{"name": res.Secret.GetName()})
+	}
+
+	// used_by is planned from the state, the services changed in the same
+	// apply are only reflected by the next refresh.
+	usedBy := plan.UsedBy
+	_, diags := r.read(ctx, &plan)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+	plan.UsedBy = usedBy
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, plan)...)
+}
+
+func (r *secretResource) Delete(ctx context.Context, req resource.DeleteRequest, resp *resource.DeleteResponse) {
+	var state secretResourceModel
+	resp.Diagnostics.Append(req.State.Get(ctx, &state)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	ctx = loggingContext(ctx, "koyeb_secret", state.ID.ValueString(), "delete")
+	name := state.Name.ValueString()
+
+	if state.PreventDestroyIfUsed.ValueBool() {
+		usedBy, err := secretUsedBy(ctx, r.client, name)
+		if err != nil {
+			resp.Diagnostics.AddError("Error retrieving services using secret", err.Error())
+			return
+		}
+
+		if len(usedBy) > 0 {
+			resp.Diagnostics.AddError("Error deleting secret", fmt.Sprintf("secret %s is still used by the following services: %s", name, strings.Join(usedBy, ", ")))
+			return
+		}
+	}
+
+	_, _, err := r.client.SecretsApi.DeleteSecret(ctx, state.ID.ValueString()).Execute()
+	if err != nil {
+		resp.Diagnostics.Append(frameworkDiagnostics(apiErrorDiagnostics("Error deleting secret", err, secretSchema()))...)
+		return
+	}
+
+	r.client.ids.forget(idKindSecret, name)
+}
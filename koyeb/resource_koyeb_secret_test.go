@@ -4,9 +4,20 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"reflect"
 	"strings"
 	"testing"
+	"unicode/utf8"
 
+	"github.com/hashicorp/go-cty/cty"
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	fwresource "github.com/hashicorp/terraform-plugin-framework/resource"
+	fwschema "github.com/hashicorp/terraform-plugin-framework/resource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/listplanmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/tfsdk"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/terraform-plugin-go/tftypes"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
 	"github.com/koyeb/koyeb-api-client-go/api/v1/koyeb"
@@ -16,6 +27,8 @@ func init() {
 	resource.AddTestSweepers("koyeb_secret", &resource.Sweeper{
 		Name: "koyeb_secret",
 		F:    testSweepSecret,
+		// The services of the tests reference their secrets
+		Dependencies: []string{"koyeb_service"},
 	})
 
 }
@@ -26,24 +39,392 @@ func testSweepSecret(string) error {
 		return err
 	}
 
-	client := meta.(*koyeb.APIClient)
+	client := meta.(*Client)
+	ctx := context.Background()
 
-	res, _, err := client.SecretsApi.ListSecrets(context.Background()).Limit("100").Execute()
+	secrets, err := sweepList(func(limit string, offset string) ([]koyeb.Secret, int64, error) {
+		res, _, err := client.SecretsApi.ListSecrets(ctx).Limit(limit).Offset(offset).Execute()
+		return res.GetSecrets(), res.GetCount(), err
+	})
 	if err != nil {
-		return err
+		return fmt.Errorf("error listing secrets: %w", err)
 	}
 
-	for _, d := range *res.Secrets {
-		if strings.HasPrefix(d.GetName(), testNamePrefix) {
-			log.Printf("Destroying secret %s", *d.Name)
+	var result *multierror.Error
+	for _, s := range secrets {
+		if !isTestName(s.GetName()) {
+			continue
+		}
+
+		log.Printf("Destroying secret %s", s.GetName())
 
-			if _, _, err := client.SecretsApi.DeleteSecret(context.Background(), d.GetId()).Execute(); err != nil {
-				return err
-			}
+		if _, resp, err := client.SecretsApi.DeleteSecret(ctx, s.GetId()).Execute(); err != nil && !sweepNotFound(resp) {
+			result = multierror.Append(result, fmt.Errorf("error deleting secret %s: %w", s.GetName(), err))
 		}
 	}
 
-	return nil
+	return result.ErrorOrNil()
+}
+
+func TestResourceKoyebSecret_UsedByKeepsState(t *testing.T) {
+	resp := &fwresource.SchemaResponse{}
+	(&secretResource{}).Schema(context.Background(), fwresource.SchemaRequest{}, resp)
+
+	usedBy, ok := resp.Schema.Attributes["used_by"].(fwschema.ListAttribute)
+	if !ok {
+		t.Fatalf("expected used_by to be a list attribute")
+	}
+	if len(usedBy.PlanModifiers) != 1 || usedBy.PlanModifiers[0].Description(context.Background()) != listplanmodifier.UseStateForUnknown().Description(context.Background()) {
+		t.Errorf("expected used_by to be planned from the state, got %v", usedBy.PlanModifiers)
+	}
+}
+
+func TestResourceKoyebSecretStateUpgradeV0(t *testing.T) {
+	state := testUpgradeResourceState(t, "koyeb_secret", 0, `{
+		"id": "secret-id",
+		"name": "secret",
+		"type": "SIMPLE",
+		"value": "",
+		"rotation_trigger": "",
+		"keeper_hash": "hash",
+		"generate": [{"length": 32, "lower": true, "upper": true, "numeric": true, "special": true, "override_special": ""}],
+		"docker_hub_registry": [],
+		"organization_id": "organization-id",
+		"created_at": "2022-06-01 10:00:00 +0000 UTC",
+		"updated_at": "2022-06-01 10:00:00 +0000 UTC"
+	}`)
+
+	for path, expected := range map[string]tftypes.Value{
+		"name":                    tftypes.NewValue(tftypes.String, "secret"),
+		"value":                   tftypes.NewValue(tftypes.String, nil),
+		"rotation_trigger":        tftypes.NewValue(tftypes.String, nil),
+		"prevent_destroy_if_used": tftypes.NewValue(tftypes.Bool, false),
+		"created_at":              tftypes.NewValue(tftypes.String, "2022-06-01T10:00:00Z"),
+	} {
+		if value := testStateAttribute(t, state, path); !value.Equal(expected) {
+			t.Errorf("expected %s to be %s, got %s", path, expected, value)
+		}
+	}
+
+	var generate []tftypes.Value
+	if err := testStateAttribute(t, state, "generate").As(&generate); err != nil || len(generate) != 1 {
+		t.Fatalf("expected a generate block, got %v (%v)", generate, err)
+	}
+
+	var attributes map[string]tftypes.Value
+	generate[0].As(&attributes)
+	if !attributes["override_special"].IsNull() || !attributes["length"].Equal(tftypes.NewValue(tftypes.Number, 32)) {
+		t.Errorf("unexpected generate block: %v", attributes)
+	}
+
+	for _, block := range []string{"github_registry", "private_registry"} {
+		if value := testStateAttribute(t, state, block); value.IsNull() {
+			t.Errorf("expected %s to be an empty set", block)
+		}
+	}
+}
+
+func TestResourceKoyebSecretStateUpgradeV0_Fixture(t *testing.T) {
+	// The framework decodes the state with the prior schema itself
+	state := testUpgradeResourceState(t, "koyeb_secret", 0, testStateFixture(t, "koyeb_secret_v0", cty.NilType))
+
+	for path, expected := range map[string]tftypes.Value{
+		"name":                    tftypes.NewValue(tftypes.String, "token"),
+		"value":                   tftypes.NewValue(tftypes.String, "s3cr3t"),
+		"keeper_hash":             tftypes.NewValue(tftypes.String, nil),
+		"prevent_destroy_if_used": tftypes.NewValue(tftypes.Bool, false),
+		"created_at":              tftypes.NewValue(tftypes.String, "2022-06-01T10:00:00Z"),
+	} {
+		if value := testStateAttribute(t, state, path); !value.Equal(expected) {
+			t.Errorf("expected %s to be %s, got %s", path, expected, value)
+		}
+	}
+}
+
+func TestResourceKoyebSecretStateUpgradeV1(t *testing.T) {
+	state := testUpgradeResourceState(t, "koyeb_secret", 1, `{
+		"id": "secret-id",
+		"name": "secret",
+		"type": "SIMPLE",
+		"prevent_destroy_if_used": false,
+		"created_at": "2022-06-01 10:00:00.123 +0000 UTC",
+		"updated_at": "0001-01-01 00:00:00 +0000 UTC"
+	}`)
+
+	for path, expected := range map[string]tftypes.Value{
+		"created_at": tftypes.NewValue(tftypes.String, "2022-06-01T10:00:00Z"),
+		"updated_at": tftypes.NewValue(tftypes.String, nil),
+	} {
+		if value := testStateAttribute(t, state, path); !value.Equal(expected) {
+			t.Errorf("expected %s to be %s, got %s", path, expected, value)
+		}
+	}
+}
+
+func TestResourceKoyebSecretStateUpgradeV2(t *testing.T) {
+	const keeperHash = "0b14d501a594442a01c6859541bcb3e8164d183d32937b851835442f69d5c94e"
+
+	state := testUpgradeResourceState(t, "koyeb_secret", 2, `{
+		"id": "secret-id",
+		"name": "secret",
+		"type": "SIMPLE",
+		"keeper_hash": "`+keeperHash+`",
+		"generate": [{"length": 8, "lower": true, "upper": true, "numeric": true, "special": true}],
+		"prevent_destroy_if_used": false,
+		"created_at": "2022-06-01T10:00:00Z"
+	}`)
+
+	var value string
+	if err := testStateAttribute(t, state, "keeper_hash").As(&value); err != nil || value == "" || value == keeperHash {
+		t.Errorf("expected the hash of the value to be replaced with a random keeper_hash, got %q", value)
+	}
+}
+
+// testSecretModel builds a secret plan from the values of its attributes and
+// blocks, the others are null.
+func testSecretModel(t *testing.T, attributes map[string]interface{}) secretResourceModel {
+	ctx := context.Background()
+	resp := &fwresource.SchemaResponse{}
+	(&secretResource{}).Schema(ctx, fwresource.SchemaRequest{}, resp)
+
+	plan := tfsdk.Plan{Schema: resp.Schema, Raw: tftypes.NewValue(resp.Schema.Type().TerraformType(ctx), nil)}
+	for name, value := range attributes {
+		if diags := plan.SetAttribute(ctx, path.Root(name), value); diags.HasError() {
+			t.Fatalf("cannot set %s: %v", name, diags)
+		}
+	}
+
+	var model secretResourceModel
+	if diags := plan.Get(ctx, &model); diags.HasError() {
+		t.Fatalf("cannot read the plan: %v", diags)
+	}
+
+	return model
+}
+
+func TestExpandSecret(t *testing.T) {
+	registry := []registryModel{{Username: types.StringValue("user"), Password: types.StringValue("password")}}
+
+	cases := []struct {
+		name       string
+		attributes map[string]interface{}
+		want       koyeb.Secret
+		wantErr    bool
+	}{
+		{
+			"value",
+			map[string]interface{}{"name": "secret", "type": "SIMPLE", "value": "value"},
+			koyeb.Secret{Name: toOpt("secret"), Type: toOpt(koyeb.SECRETTYPE_SIMPLE), Value: toOpt("value")},
+			false,
+		},
+		{
+			"empty value",
+			map[string]interface{}{"name": "secret", "type": "SIMPLE", "value": ""},
+			koyeb.Secret{Name: toOpt("secret"), Type: toOpt(koyeb.SECRETTYPE_SIMPLE)},
+			false,
+		},
+		{
+			"docker hub registry",
+			map[string]interface{}{"name": "secret", "type": "REGISTRY", "docker_hub_registry": registry},
+			koyeb.Secret{
+				Name:              toOpt("secret"),
+				Type:              toOpt(koyeb.SECRETTYPE_REGISTRY),
+				DockerHubRegistry: &koyeb.DockerHubRegistryConfiguration{Username: toOpt("user"), Password: toOpt("password")},
+			},
+			false,
+		},
+		{
+			"github registry",
+			map[string]interface{}{"name": "secret", "type": "REGISTRY", "github_registry": registry},
+			koyeb.Secret{
+				Name:           toOpt("secret"),
+				Type:           toOpt(koyeb.SECRETTYPE_REGISTRY),
+				GithubRegistry: &koyeb.GitHubRegistryConfiguration{Username: toOpt("user"), Password: toOpt("password")},
+			},
+			false,
+		},
+		{
+			"gitlab registry",
+			map[string]interface{}{"name": "secret", "type": "REGISTRY", "gitlab_registry": registry},
+			koyeb.Secret{
+				Name:           toOpt("secret"),
+				Type:           toOpt(koyeb.SECRETTYPE_REGISTRY),
+				GitlabRegistry: &koyeb.GitLabRegistryConfiguration{Username: toOpt("user"), Password: toOpt("password")},
+			},
+			false,
+		},
+		{
+			"digital ocean registry",
+			map[string]interface{}{"name": "secret", "type": "REGISTRY", "digital_ocean_container_registry": registry},
+			koyeb.Secret{
+				Name:                 toOpt("secret"),
+				Type:                 toOpt(koyeb.SECRETTYPE_REGISTRY),
+				DigitalOceanRegistry: &koyeb.DigitalOceanRegistryConfiguration{Username: toOpt("user"), Password: toOpt("password")},
+			},
+			false,
+		},
+		{
+			"private registry",
+			map[string]interface{}{"name": "secret", "type": "REGISTRY", "private_registry": []privateRegistryModel{{
+				Username: types.StringValue("user"),
+				Password: types.StringValue("password"),
+				URL:      types.StringValue("registry.example.com"),
+			}}},
+			koyeb.Secret{
+				Name:            toOpt("secret"),
+				Type:            toOpt(koyeb.SECRETTYPE_REGISTRY),
+				PrivateRegistry: &koyeb.PrivateRegistryConfiguration{Username: toOpt("user"), Password: toOpt("password"), Url: toOpt("registry.example.com")},
+			},
+			false,
+		},
+		{
+			"azure registry",
+			map[string]interface{}{"name": "secret", "type": "REGISTRY", "azure_container_registry": []azureRegistryModel{{
+				Username:     types.StringValue("user"),
+				Password:     types.StringValue("password"),
+				RegistryName: types.StringValue("registry"),
+			}}},
+			koyeb.Secret{
+				Name:                   toOpt("secret"),
+				Type:                   toOpt(koyeb.SECRETTYPE_REGISTRY),
+				AzureContainerRegistry: &koyeb.AzureContainerRegistryConfiguration{Username: toOpt("user"), Password: toOpt("password"), RegistryName: toOpt("registry")},
+			},
+			false,
+		},
+		{
+			"generate on a registry secret",
+			map[string]interface{}{"name": "secret", "type": "REGISTRY", "generate": []secretGenerateModel{{
+				Length:  types.Int64Value(16),
+				Lower:   types.BoolValue(true),
+				Upper:   types.BoolValue(true),
+				Numeric: types.BoolValue(true),
+				Special: types.BoolValue(true),
+			}}},
+			koyeb.Secret{Name: toOpt("secret"), Type: toOpt(koyeb.SECRETTYPE_REGISTRY)},
+			true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			plan := testSecretModel(t, c.attributes)
+
+			got, diags := expandSecret(context.Background(), &plan, true)
+			if diags.HasError() != c.wantErr {
+				t.Fatalf("expected an error: %t, got %v", c.wantErr, diags)
+			}
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("got %+v, want %+v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestExpandSecret_Generate(t *testing.T) {
+	generate := []secretGenerateModel{{
+		Length:  types.Int64Value(16),
+		Lower:   types.BoolValue(true),
+		Upper:   types.BoolValue(false),
+		Numeric: types.BoolValue(false),
+		Special: types.BoolValue(false),
+	}}
+
+	plan := testSecretModel(t, map[string]interface{}{"name": "secret", "type": "SIMPLE", "generate": generate, "keeper_hash": "previous"})
+	secret, diags := expandSecret(context.Background(), &plan, true)
+	if diags.HasError() {
+		t.Fatalf("unexpected error: %v", diags)
+	}
+	if len(secret.GetValue()) != 16 || strings.Trim(secret.GetValue(), secretGenerateLowerChars) != "" {
+		t.Errorf("expected 16 lowercase characters, got %q", secret.GetValue())
+	}
+	if plan.KeeperHash.ValueString() == "previous" {
+		t.Errorf("expected a new keeper hash")
+	}
+
+	plan = testSecretModel(t, map[string]interface{}{"name": "secret", "type": "SIMPLE", "generate": generate, "keeper_hash": "previous"})
+	secret, diags = expandSecret(context.Background(), &plan, false)
+	if diags.HasError() {
+		t.Fatalf("unexpected error: %v", diags)
+	}
+	if secret.Value != nil || plan.KeeperHash.ValueString() != "previous" {
+		t.Errorf("expected the value to be kept, got %v and keeper hash %s", secret.Value, plan.KeeperHash)
+	}
+}
+
+func TestGenerateSecretValue(t *testing.T) {
+	cases := []struct {
+		name    string
+		length  int
+		classes []string
+		err     bool
+	}{
+		{name: "every class", length: 32, classes: secretGenerateClasses(true, true, true, true, "")},
+		{name: "one character per class", length: 4, classes: secretGenerateClasses(true, true, true, true, "")},
+		{name: "lower only", length: 16, classes: secretGenerateClasses(true, false, false, false, "")},
+		{name: "override special", length: 16, classes: secretGenerateClasses(false, false, true, true, "-_")},
+		{name: "multibyte override special", length: 16, classes: secretGenerateClasses(true, false, false, true, "€£")},
+		{name: "every class disabled", length: 16, classes: secretGenerateClasses(false, false, false, false, ""), err: true},
+		{name: "shorter than the classes", length: 3, classes: secretGenerateClasses(true, true, true, true, ""), err: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			for i := 0; i < 100; i++ {
+				value, err := generateSecretValue(c.length, c.classes)
+				if c.err {
+					if err == nil {
+						t.Fatalf("expected an error, got %q", value)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+
+				if !utf8.ValidString(value) {
+					t.Fatalf("expected a valid UTF-8 value, got %q", value)
+				}
+				if n := utf8.RuneCountInString(value); n != c.length {
+					t.Fatalf("expected %d characters, got %d in %q", c.length, n, value)
+				}
+
+				charset := strings.Join(c.classes, "")
+				for _, r := range value {
+					if !strings.ContainsRune(charset, r) {
+						t.Fatalf("unexpected character %q in %q", r, value)
+					}
+				}
+				for _, class := range c.classes {
+					if !strings.ContainsAny(value, class) {
+						t.Fatalf("expected a character of %q in %q", class, value)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestSecretGenerateClasses(t *testing.T) {
+	cases := []struct {
+		name                           string
+		lower, upper, numeric, special bool
+		overrideSpecial                string
+		expected                       []string
+	}{
+		{"every class", true, true, true, true, "", []string{secretGenerateLowerChars, secretGenerateUpperChars, secretGenerateNumericChars, secretGenerateSpecialChars}},
+		{"override special", false, false, false, true, "€-", []string{"€-"}},
+		{"override special without special", true, false, false, false, "€-", []string{secretGenerateLowerChars}},
+		{"every class disabled", false, false, false, false, "", []string{}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			classes := secretGenerateClasses(c.lower, c.upper, c.numeric, c.special, c.overrideSpecial)
+			if !reflect.DeepEqual(classes, c.expected) {
+				t.Errorf("expected %q, got %q", c.expected, classes)
+			}
+		})
+	}
 }
 
 func TestAccKoyebSecret_Basic(t *testing.T) {
@@ -52,9 +433,9 @@ func TestAccKoyebSecret_Basic(t *testing.T) {
 	secretValue := randomTestName()
 
 	resource.ParallelTest(t, resource.TestCase{
-		PreCheck:          func() { testAccPreCheck(t) },
-		ProviderFactories: testAccProviderFactories,
-		CheckDestroy:      testAccCheckKoyebSecretDestroy,
+		PreCheck:                 func() { testAccPreCheck(t) },
+		ProtoV5ProviderFactories: testAccProtoV5ProviderFactories,
+		CheckDestroy:             testAccCheckKoyebSecretDestroy,
 		Steps: []resource.TestStep{
 			{
 				Config: fmt.Sprintf(testAccCheckKoyebSecretConfig_basic, secretName, secretValue),
@@ -66,6 +447,7 @@ func TestAccKoyebSecret_Basic(t *testing.T) {
 					resource.TestCheckResourceAttrSet("koyeb_secret.foo", "id"),
 					resource.TestCheckResourceAttrSet("koyeb_secret.foo", "organization_id"),
 					resource.TestCheckResourceAttrSet("koyeb_secret.foo", "type"),
+					resource.TestCheckResourceAttr("koyeb_secret.foo", "used_by.#", "0"),
 				),
 			},
 			{
@@ -84,8 +466,84 @@ func TestAccKoyebSecret_Basic(t *testing.T) {
 	})
 }
 
+func TestAccKoyebSecret_Generate(t *testing.T) {
+	var secret koyeb.Secret
+	var keeperHash string
+	secretName := randomTestName()
+
+	resource.ParallelTest(t, resource.TestCase{
+		PreCheck:                 func() { testAccPreCheck(t) },
+		ProtoV5ProviderFactories: testAccProtoV5ProviderFactories,
+		CheckDestroy:             testAccCheckKoyebSecretDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: fmt.Sprintf(testAccCheckKoyebSecretConfig_generate, secretName, "v1"),
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckKoyebSecretExists("koyeb_secret.foo", &secret),
+					testAccCheckKoyebSecretAttributes(&secret, secretName),
+					resource.TestCheckResourceAttrSet("koyeb_secret.foo", "keeper_hash"),
+					resource.TestCheckNoResourceAttr("koyeb_secret.foo", "value"),
+					testAccCheckKoyebSecretKeeperHash("koyeb_secret.foo", &keeperHash, false),
+				),
+			},
+			{
+				Config: fmt.Sprintf(testAccCheckKoyebSecretConfig_generate, secretName, "v2"),
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckKoyebSecretExists("koyeb_secret.foo", &secret),
+					resource.TestCheckResourceAttr("koyeb_secret.foo", "rotation_trigger", "v2"),
+					testAccCheckKoyebSecretKeeperHash("koyeb_secret.foo", &keeperHash, true),
+				),
+			},
+		},
+	})
+}
+
+func TestAccKoyebSecret_UsedBy(t *testing.T) {
+	var secret koyeb.Secret
+	appName := randomTestName()
+	secretName := randomTestName()
+
+	resource.ParallelTest(t, resource.TestCase{
+		PreCheck:                 func() { testAccPreCheck(t) },
+		ProtoV5ProviderFactories: testAccProtoV5ProviderFactories,
+		CheckDestroy:             testAccCheckKoyebSecretDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: fmt.Sprintf(testAccCheckKoyebSecretConfig_used_by, secretName, appName),
+			},
+			{
+				Config: fmt.Sprintf(testAccCheckKoyebSecretConfig_used_by, secretName, appName),
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckKoyebSecretExists("koyeb_secret.foo", &secret),
+					resource.TestCheckResourceAttr("koyeb_secret.foo", "used_by.#", "1"),
+					resource.TestCheckResourceAttr("koyeb_secret.foo", "used_by.0", appName+"/main"),
+				),
+			},
+		},
+	})
+}
+
+func testAccCheckKoyebSecretKeeperHash(n string, keeperHash *string, changed bool) resource.TestCheckFunc {
+	return func(s *terraform.State) error {
+		rs, ok := s.RootModule().Resources[n]
+
+		if !ok {
+			return fmt.Errorf("Not found: %s", n)
+		}
+
+		current := rs.Primary.Attributes["keeper_hash"]
+		if changed && current == *keeperHash {
+			return fmt.Errorf("Keeper hash was not updated: %s", current)
+		}
+
+		*keeperHash = current
+
+		return nil
+	}
+}
+
 func testAccCheckKoyebSecretDestroy(s *terraform.State) error {
-	client := testAccProvider.Meta().(*koyeb.APIClient)
+	client := testAccProvider.Meta().(*Client)
 
 	for _, rs := range s.RootModule().Resources {
 		if rs.Type != "koyeb_secret" {
@@ -123,7 +581,7 @@ func testAccCheckKoyebSecretExists(n string, secret *koyeb.Secret) resource.Test
 			return fmt.Errorf("No Record ID is set")
 		}
 
-		client := testAccProvider.Meta().(*koyeb.APIClient)
+		client := testAccProvider.Meta().(*Client)
 
 		res, _, err := client.SecretsApi.GetSecret(context.Background(), rs.Primary.ID).Execute()
 
@@ -156,3 +614,54 @@ resource "koyeb_secret" "foo" {
 		password = "%s"
 	}
 }`
+
+const testAccCheckKoyebSecretConfig_generate = `
+resource "koyeb_secret" "foo" {
+	name             = "%s"
+	rotation_trigger = "%s"
+	generate {
+		length           = 48
+		override_special = "-_"
+	}
+}`
+
+const testAccCheckKoyebSecretConfig_used_by = `
+resource "koyeb_secret" "foo" {
+	name                    = "%s"
+	value                   = "bar"
+	prevent_destroy_if_used = true
+}
+
+resource "koyeb_app" "foo" {
+	name = "%s"
+}
+
+resource "koyeb_service" "bar" {
+	app_name = koyeb_app.foo.name
+	definition {
+		name = "main"
+		instance_types {
+		  type = "micro"
+		}
+		ports {
+		  port     = 3000
+		  protocol = "http"
+		}
+		scalings {
+		  min = 1
+		  max = 1
+		}
+		env {
+		  key    = "FOO"
+		  secret = koyeb_secret.foo.name
+		}
+		routes {
+		  path = "/"
+		  port = 3000
+		}
+		regions = ["par"]
+		docker {
+		  image = "koyeb/demo"
+		}
+	}
+}`
@@ -0,0 +1,282 @@
+package koyeb
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/koyeb/koyeb-api-client-go/api/v1/koyeb"
+)
+
+// secretsMaxConcurrency bounds the number of API calls koyeb_secrets runs in parallel.
+const secretsMaxConcurrency = 5
+
+func secretsSchema() map[string]*schema.Schema {
+	secrets := map[string]*schema.Schema{
+		"id": {
+			Type:        schema.TypeString,
+			Computed:    true,
+			Description: "The ID of the secret collection",
+		},
+		"name_prefix": {
+			Type:        schema.TypeString,
+			Optional:    true,
+			ForceNew:    true,
+			Description: "The prefix prepended to every key to build the secret names",
+		},
+		"values": {
+			Type:        schema.TypeMap,
+			Required:    true,
+			Sensitive:   true,
+			Description: "The secret values, indexed by secret name",
+			Elem:        &schema.Schema{Type: schema.TypeString},
+		},
+		"secret_ids": {
+			Type:        schema.TypeMap,
+			Computed:    true,
+			Description: "The secret IDs, indexed by secret name",
+			Elem:        &schema.Schema{Type: schema.TypeString},
+		},
+	}
+
+	return secrets
+}
+
+func resourceKoyebSecrets() *schema.Resource {
+	return &schema.Resource{
+		// This description is used by the documentation generator and the language server.
+		Description: "Secrets resource in the Koyeb Terraform provider, managing a collection of simple secrets from a map.",
+
+		CreateContext: resourceKoyebSecretsCreate,
+		ReadContext:   resourceKoyebSecretsRead,
+		UpdateContext: resourceKoyebSecretsUpdate,
+		DeleteContext: resourceKoyebSecretsDelete,
+
+		Schema: secretsSchema(),
+	}
+}
+
+// secretsOperation is a single API call applied to one key of koyeb_secrets.
+type secretsOperation struct {
+	key   string
+	value string
+	id    string
+}
+
+// runSecretsOperations runs fn for every operation with at most
+// secretsMaxConcurrency calls in flight and collects the resulting diagnostics.
+func runSecretsOperations(ctx context.Context, operations []secretsOperation, fn func(context.Context, secretsOperation) diag.Diagnostics) diag.Diagnostics {
+	var diags diag.Diagnostics
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	sem := make(chan struct{}, secretsMaxConcurrency)
+
+	for _, op := range operations {
+		wg.Add(1)
+		sem <- struct{}{}
+
+		go func(op secretsOperation) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			if d := fn(ctx, op); d.HasError() {
+				mu.Lock()
+				diags = append(diags, d...)
+				mu.Unlock()
+			}
+		}(op)
+	}
+
+	wg.Wait()
+
+	return diags
+}
+
+func resourceKoyebSecretsCreate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	d.SetId(resource.UniqueId())
+
+	diags := resourceKoyebSecretsApply(ctx, d, meta, map[string]interface{}{}, map[string]string{})
+	if diags.HasError() {
+		return diags
+	}
+
+	return resourceKoyebSecretsRead(ctx, d, meta)
+}
+
+func resourceKoyebSecretsRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	client := meta.(*Client)
+
+	secretIds := expandStringMap(d.Get("secret_ids").(map[string]interface{}))
+	values := d.Get("values").(map[string]interface{})
+
+	var mu sync.Mutex
+	operations := make([]secretsOperation, 0, len(secretIds))
+	for key, id := range secretIds {
+		operations = append(operations, secretsOperation{key: key, id: id})
+	}
+
+	diags := runSecretsOperations(ctx, operations, func(ctx context.Context, op secretsOperation) diag.Diagnostics {
+		_, resp, err := client.SecretsApi.GetSecret(ctx, op.id).Execute()
+		if err != nil {
+			// If the secret is somehow already destroyed, drop it from the
+			// state so it gets recreated
+			if resp != nil && resp.StatusCode == 404 {
+				mu.Lock()
+				delete(secretIds, op.key)
+				delete(values, op.key)
+				mu.Unlock()
+				return nil
+			}
+
+			return apiErrorDiagnostics(fmt.Sprintf("Error retrieving secret %s", op.key), err, nil)
+		}
+
+		return nil
+	})
+	if diags.HasError() {
+		return diags
+	}
+
+	d.Set("secret_ids", secretIds)
+	d.Set("values", values)
+
+	return nil
+}
+
+func resourceKoyebSecretsUpdate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	oldValues, _ := d.GetChange("values")
+	secretIds := expandStringMap(d.Get("secret_ids").(map[string]interface{}))
+
+	diags := resourceKoyebSecretsApply(ctx, d, meta, oldValues.(map[string]interface{}), secretIds)
+	if diags.HasError() {
+		return diags
+	}
+
+	return resourceKoyebSecretsRead(ctx, d, meta)
+}
+
+// resourceKoyebSecretsApply diffs the old and new values key by key and
+// creates, updates or deletes the matching secrets. The state only records the
+// keys whose API call succeeded, so a partial failure is retried on the next apply.
+func resourceKoyebSecretsApply(ctx context.Context, d *schema.ResourceData, meta interface{}, oldValues map[string]interface{}, secretIds map[string]string) diag.Diagnostics {
+	client := meta.(*Client)
+	prefix := d.Get("name_prefix").(string)
+	newValues := d.Get("values").(map[string]interface{})
+
+	appliedValues := map[string]interface{}{}
+	for key, value := range oldValues {
+		if _, ok := secretIds[key]; ok {
+			appliedValues[key] = value
+		}
+	}
+
+	var toCreate, toUpdate, toDelete []secretsOperation
+	for key, value := range newValues {
+		id, ok := secretIds[key]
+		if !ok {
+			toCreate = append(toCreate, secretsOperation{key: key, value: value.(string)})
+		} else if oldValues[key] != value {
+			toUpdate = append(toUpdate, secretsOperation{key: key, value: value.(string), id: id})
+		}
+	}
+	for key, id := range secretIds {
+		if _, ok := newValues[key]; !ok {
+			toDelete = append(toDelete, secretsOperation{key: key, id: id})
+		}
+	}
+
+	var mu sync.Mutex
+	var diags diag.Diagnostics
+
+	diags = append(diags, runSecretsOperations(ctx, toCreate, func(ctx context.Context, op secretsOperation) diag.Diagnostics {
+		res, _, err := client.SecretsApi.CreateSecret(ctx).Body(koyeb.CreateSecret{
+			Name:  toOpt(prefix + op.key),
+			Type:  toOpt(koyeb.SECRETTYPE_SIMPLE),
+			Value: toOpt(op.value),
+		}).Execute()
+		if err != nil {
+			return apiErrorDiagnostics(fmt.Sprintf("Error creating secret %s", prefix+op.key), err, nil)
+		}
+
+		mu.Lock()
+		secretIds[op.key] = res.Secret.GetId()
+		appliedValues[op.key] = op.value
+		mu.Unlock()
+
+		tflog.Info(ctx, "Created secret", map[string]interface{}{"name": res.Secret.GetName(), "id": res.Secret.GetId()})
+		client.ids.set(idKindSecret, res.Secret.GetName(), res.Secret.GetId())
+		return nil
+	})...)
+
+	diags = append(diags, runSecretsOperations(ctx, toUpdate, func(ctx context.Context, op secretsOperation) diag.Diagnostics {
+		res, _, err := client.SecretsApi.UpdateSecret(ctx, op.id).Body(koyeb.Secret{
+			Name:  toOpt(prefix + op.key),
+			Type:  toOpt(koyeb.SECRETTYPE_SIMPLE),
+			Value: toOpt(op.value),
+		}).Execute()
+		if err != nil {
+			return apiErrorDiagnostics(fmt.Sprintf("Error updating secret %s", prefix+op.key), err, nil)
+		}
+
+		mu.Lock()
+		appliedValues[op.key] = op.value
+		mu.Unlock()
+
+		tflog.Info(ctx, "Updated secret", map[string]interface{}{"name": res.Secret.GetName()})
+		return nil
+	})...)
+
+	diags = append(diags, runSecretsOperations(ctx, toDelete, func(ctx context.Context, op secretsOperation) diag.Diagnostics {
+		_, resp, err := client.SecretsApi.DeleteSecret(ctx, op.id).Execute()
+		if err != nil && (resp == nil || resp.StatusCode != 404) {
+			return apiErrorDiagnostics(fmt.Sprintf("Error deleting secret %s", prefix+op.key), err, nil)
+		}
+
+		mu.Lock()
+		delete(secretIds, op.key)
+		delete(appliedValues, op.key)
+		mu.Unlock()
+
+		tflog.Info(ctx, "Deleted secret", map[string]interface{}{"name": prefix + op.key})
+		client.ids.forget(idKindSecret, prefix+op.key)
+		return nil
+	})...)
+
+	d.Set("secret_ids", secretIds)
+	if diags.HasError() {
+		d.Set("values", appliedValues)
+	}
+
+	return diags
+}
+
+func resourceKoyebSecretsDelete(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	client := meta.(*Client)
+	prefix := d.Get("name_prefix").(string)
+
+	operations := []secretsOperation{}
+	for key, id := range expandStringMap(d.Get("secret_ids").(map[string]interface{})) {
+		operations = append(operations, secretsOperation{key: key, id: id})
+	}
+
+	diags := runSecretsOperations(ctx, operations, func(ctx context.Context, op secretsOperation) diag.Diagnostics {
+		_, resp, err := client.SecretsApi.DeleteSecret(ctx, op.id).Execute()
+		if err != nil && (resp == nil || resp.StatusCode != 404) {
+			return apiErrorDiagnostics(fmt.Sprintf("Error deleting secret %s", prefix+op.key), err, nil)
+		}
+
+		client.ids.forget(idKindSecret, prefix+op.key)
+		return nil
+	})
+	if diags.HasError() {
+		return diags
+	}
+
+	d.SetId("")
+	return nil
+}
@@ -0,0 +1,117 @@
+package koyeb
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+)
+
+func TestAccKoyebSecrets_Basic(t *testing.T) {
+	prefix := randomTestName() + "-"
+
+	resource.ParallelTest(t, resource.TestCase{
+		PreCheck:                 func() { testAccPreCheck(t) },
+		ProtoV5ProviderFactories: testAccProtoV5ProviderFactories,
+		CheckDestroy:             testAccCheckKoyebSecretsDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: fmt.Sprintf(testAccCheckKoyebSecretsConfig_basic, prefix),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttrSet("koyeb_secrets.foo", "id"),
+					resource.TestCheckResourceAttr("koyeb_secrets.foo", "secret_ids.%", "2"),
+					resource.TestCheckResourceAttrSet("koyeb_secrets.foo", "secret_ids.FOO"),
+					resource.TestCheckResourceAttrSet("koyeb_secrets.foo", "secret_ids.BAR"),
+					testAccCheckKoyebSecretsExist("koyeb_secrets.foo", prefix),
+				),
+			},
+			{
+				Config: fmt.Sprintf(testAccCheckKoyebSecretsConfig_update, prefix),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("koyeb_secrets.foo", "secret_ids.%", "2"),
+					resource.TestCheckResourceAttrSet("koyeb_secrets.foo", "secret_ids.FOO"),
+					resource.TestCheckResourceAttrSet("koyeb_secrets.foo", "secret_ids.BAZ"),
+					resource.TestCheckNoResourceAttr("koyeb_secrets.foo", "secret_ids.BAR"),
+					testAccCheckKoyebSecretsExist("koyeb_secrets.foo", prefix),
+				),
+			},
+		},
+	})
+}
+
+func testAccCheckKoyebSecretsDestroy(s *terraform.State) error {
+	client := testAccProvider.Meta().(*Client)
+
+	for _, rs := range s.RootModule().Resources {
+		if rs.Type != "koyeb_secrets" {
+			continue
+		}
+
+		for k, id := range rs.Primary.Attributes {
+			if k == "secret_ids.%" || !strings.HasPrefix(k, "secret_ids.") {
+				continue
+			}
+
+			_, _, err := client.SecretsApi.GetSecret(context.Background(), id).Execute()
+			if err == nil {
+				return fmt.Errorf("Secret still exists: %s", id)
+			}
+		}
+	}
+
+	return nil
+}
+
+func testAccCheckKoyebSecretsExist(n string, prefix string) resource.TestCheckFunc {
+	return func(s *terraform.State) error {
+		rs, ok := s.RootModule().Resources[n]
+
+		if !ok {
+			return fmt.Errorf("Not found: %s", n)
+		}
+
+		if rs.Primary.ID == "" {
+			return fmt.Errorf("No Record ID is set")
+		}
+
+		client := testAccProvider.Meta().(*Client)
+
+		for k, id := range rs.Primary.Attributes {
+			if k == "secret_ids.%" || !strings.HasPrefix(k, "secret_ids.") {
+				continue
+			}
+
+			res, _, err := client.SecretsApi.GetSecret(context.Background(), id).Execute()
+			if err != nil {
+				return err
+			}
+
+			if name := prefix + strings.TrimPrefix(k, "secret_ids."); res.Secret.GetName() != name {
+				return fmt.Errorf("Bad name: %s, expected %s", res.Secret.GetName(), name)
+			}
+		}
+
+		return nil
+	}
+}
+
+const testAccCheckKoyebSecretsConfig_basic = `
+resource "koyeb_secrets" "foo" {
+	name_prefix = "%s"
+	values = {
+		FOO = "foo"
+		BAR = "bar"
+	}
+}`
+
+const testAccCheckKoyebSecretsConfig_update = `
+resource "koyeb_secrets" "foo" {
+	name_prefix = "%s"
+	values = {
+		FOO = "foo-updated"
+		BAZ = "baz"
+	}
+}`
@@ -2,14 +2,16 @@ package koyeb
 
 import (
 	"context"
-	"log"
+	"fmt"
+	"net/http"
 	"strings"
 
+	"github.com/hashicorp/go-cty/cty"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
 	"github.com/koyeb/koyeb-api-client-go/api/v1/koyeb"
-	"github.com/koyeb/koyeb-cli/pkg/koyeb/idmapper"
 )
 
 func envSchema() *schema.Resource {
@@ -59,18 +61,22 @@ func expandEnvs(config []interface{}) *[]koyeb.DeploymentEnv {
 }
 
 func flattenEnvs(envs *[]koyeb.DeploymentEnv) []map[string]interface{} {
+	if envs == nil {
+		return []map[string]interface{}{}
+	}
+
 	result := make([]map[string]interface{}, len(*envs))
 
 	for i, env := range *envs {
 		r := make(map[string]interface{})
 
-		r["key"] = *env.Key
+		r["key"] = env.GetKey()
 
 		if value, ok := env.GetValueOk(); ok {
-			r["value"] = value
+			r["value"] = *value
 		}
 		if secret, ok := env.GetSecretOk(); ok {
-			r["secret"] = secret
+			r["secret"] = *secret
 		}
 
 		result[i] = r
@@ -119,13 +125,17 @@ func expandPorts(config []interface{}) *[]koyeb.DeploymentPort {
 }
 
 func flattenPorts(ports *[]koyeb.DeploymentPort) []map[string]interface{} {
+	if ports == nil {
+		return []map[string]interface{}{}
+	}
+
 	result := make([]map[string]interface{}, len(*ports))
 
 	for i, port := range *ports {
 		r := make(map[string]interface{})
 
-		r["port"] = *port.Port
-		r["protocol"] = *port.Protocol
+		r["port"] = port.GetPort()
+		r["protocol"] = port.GetProtocol()
 
 		result[i] = r
 	}
@@ -169,13 +179,17 @@ func expandRoutes(config []interface{}) *[]koyeb.DeploymentRoute {
 }
 
 func flattenRoutes(routes *[]koyeb.DeploymentRoute) []map[string]interface{} {
+	if routes == nil {
+		return []map[string]interface{}{}
+	}
+
 	result := make([]map[string]interface{}, len(*routes))
 
 	for i, route := range *routes {
 		r := make(map[string]interface{})
 
-		r["port"] = route.Port
-		r["path"] = route.Path
+		r["port"] = route.GetPort()
+		r["path"] = route.GetPath()
 
 		result[i] = r
 	}
@@ -212,12 +226,16 @@ func expandInstanceTypes(config []interface{}) *[]koyeb.DeploymentInstanceType {
 }
 
 func flattenInstanceTypes(instanceTypes *[]koyeb.DeploymentInstanceType) []map[string]interface{} {
+	if instanceTypes == nil {
+		return []map[string]interface{}{}
+	}
+
 	result := make([]map[string]interface{}, len(*instanceTypes))
 
 	for i, instanceType := range *instanceTypes {
 		r := make(map[string]interface{})
 
-		r["type"] = instanceType.Type
+		r["type"] = instanceType.GetType()
 
 		result[i] = r
 	}
@@ -246,7 +264,7 @@ func scalingSchema() *schema.Resource {
 
 func expandScalings(config []interface{}) *[]koyeb.DeploymentScaling {
 	scalings := make([]koyeb.DeploymentScaling, 0, len(config))
-	diag.Errorf("Error updating secret: %v", config)
+
 	for _, rawScaling := range config {
 		scaling := rawScaling.(map[string]interface{})
 
@@ -262,13 +280,17 @@ func expandScalings(config []interface{}) *[]koyeb.DeploymentScaling {
 }
 
 func flattenScalings(scalings *[]koyeb.DeploymentScaling) []map[string]interface{} {
+	if scalings == nil {
+		return []map[string]interface{}{}
+	}
+
 	result := make([]map[string]interface{}, len(*scalings))
 
 	for i, scaling := range *scalings {
 		r := make(map[string]interface{})
 
-		r["max"] = *scaling.Max
-		r["min"] = *scaling.Min
+		r["max"] = scaling.GetMax()
+		r["min"] = scaling.GetMin()
 
 		result[i] = r
 	}
@@ -311,8 +333,8 @@ func expandDockerSource(config []interface{}) *koyeb.DockerSource {
 		Image: toOpt(rawDockerSource["image"].(string)),
 	}
 
-	if rawDockerSource["command"] != nil {
-		dockerSource.Command = toOpt(rawDockerSource["command"].(string))
+	if command, ok := rawDockerSource["command"].(string); ok && command != "" {
+		dockerSource.Command = toOpt(command)
 	}
 
 	rawArgs := rawDockerSource["args"].([]interface{})
@@ -322,8 +344,8 @@ func expandDockerSource(config []interface{}) *koyeb.DockerSource {
 	}
 	dockerSource.Args = toOpt(args)
 
-	if rawDockerSource["image_registry_secret"] != nil {
-		dockerSource.ImageRegistrySecret = toOpt(rawDockerSource["image_registry_secret"].(string))
+	if secret, ok := rawDockerSource["image_registry_secret"].(string); ok && secret != "" {
+		dockerSource.ImageRegistrySecret = toOpt(secret)
 	}
 
 	return dockerSource
@@ -332,11 +354,15 @@ func expandDockerSource(config []interface{}) *koyeb.DockerSource {
 func flattenDocker(dockerSource *koyeb.DockerSource) []interface{} {
 	result := make([]interface{}, 0)
 
+	if dockerSource == nil {
+		return result
+	}
+
 	r := make(map[string]interface{})
-	r["image"] = dockerSource.Image
-	r["command"] = dockerSource.Command
-	r["args"] = dockerSource.Args
-	r["image_registry_secret"] = dockerSource.ImageRegistrySecret
+	r["image"] = dockerSource.GetImage()
+	r["command"] = dockerSource.GetCommand()
+	r["args"] = dockerSource.GetArgs()
+	r["image_registry_secret"] = dockerSource.GetImageRegistrySecret()
 
 	result = append(result, r)
 
@@ -381,18 +407,16 @@ func expandGitSource(config []interface{}) *koyeb.GitSource {
 	gitSource := &koyeb.GitSource{
 		Repository:     toOpt(rawGitSource["repository"].(string)),
 		Branch:         toOpt(rawGitSource["branch"].(string)),
-		BuildCommand:   toOpt(rawGitSource["build_command"].(string)),
-		RunCommand:     toOpt(rawGitSource["run_command"].(string)),
 		NoDeployOnPush: toOpt(rawGitSource["no_deploy_on_push"].(bool)),
 	}
 
-	// if rawGitSource["build_command"] != nil {
-	// 	gitSource.BuildCommand = toOpt(rawGitSource["build_command"].(string))
-	// }
+	if buildCommand, ok := rawGitSource["build_command"].(string); ok && buildCommand != "" {
+		gitSource.BuildCommand = toOpt(buildCommand)
+	}
 
-	// if rawGitSource["run_command"] != nil {
-	// 	gitSource.RunCommand = toOpt(rawGitSource["run_command"].(string))
-	// }
+	if runCommand, ok := rawGitSource["run_command"].(string); ok && runCommand != "" {
+		gitSource.RunCommand = toOpt(runCommand)
+	}
 
 	return gitSource
 }
@@ -400,12 +424,16 @@ func expandGitSource(config []interface{}) *koyeb.GitSource {
 func flattenGit(gitSource *koyeb.GitSource) []interface{} {
 	result := make([]interface{}, 0)
 
+	if gitSource == nil {
+		return result
+	}
+
 	r := make(map[string]interface{})
-	r["repository"] = gitSource.Repository
-	r["branch"] = gitSource.Branch
-	r["build_command"] = gitSource.BuildCommand
-	r["run_command"] = gitSource.RunCommand
-	r["no_deploy_on_push"] = gitSource.NoDeployOnPush
+	r["repository"] = gitSource.GetRepository()
+	r["branch"] = gitSource.GetBranch()
+	r["build_command"] = gitSource.GetBuildCommand()
+	r["run_command"] = gitSource.GetRunCommand()
+	r["no_deploy_on_push"] = gitSource.GetNoDeployOnPush()
 
 	result = append(result, r)
 
@@ -422,17 +450,15 @@ func deploymentDefinitionSchena() *schema.Resource {
 				ValidateFunc: validation.StringLenBetween(3, 64),
 			},
 			"docker": {
-				Type:     schema.TypeSet,
+				Type:     schema.TypeList,
 				Optional: true,
 				Elem:     dockerSchema(),
-				Set:      schema.HashResource(dockerSchema()),
 				MaxItems: 1,
 			},
 			"git": {
-				Type:     schema.TypeSet,
+				Type:     schema.TypeList,
 				Optional: true,
 				Elem:     gitSchema(),
-				Set:      schema.HashResource(gitSchema()),
 				MaxItems: 1,
 			},
 			"env": {
@@ -445,7 +471,7 @@ func deploymentDefinitionSchena() *schema.Resource {
 				Type:     schema.TypeSet,
 				Required: true,
 				Elem:     portSchema(),
-				Set:      schema.HashResource(routeSchema()),
+				Set:      schema.HashResource(portSchema()),
 			},
 			"routes": {
 				Type:     schema.TypeSet,
@@ -454,20 +480,18 @@ func deploymentDefinitionSchena() *schema.Resource {
 				Set:      schema.HashResource(routeSchema()),
 			},
 			"instance_types": {
-				Type:     schema.TypeSet,
+				Type:     schema.TypeList,
 				Required: true,
 				MinItems: 1,
 				MaxItems: 1,
 				Elem:     instanceTypeSchema(),
-				Set:      schema.HashResource(instanceTypeSchema()),
 			},
 			"scalings": {
-				Type:     schema.TypeSet,
+				Type:     schema.TypeList,
 				Required: true,
 				MinItems: 1,
 				MaxItems: 1,
 				Elem:     scalingSchema(),
-				Set:      schema.HashResource(scalingSchema()),
 			},
 			"regions": {
 				Type:        schema.TypeSet,
@@ -490,6 +514,10 @@ func expandRegions(regions []interface{}) *[]string {
 
 func flattenRegions(regions *[]string) *schema.Set {
 	flattenedRegions := schema.NewSet(schema.HashString, []interface{}{})
+	if regions == nil {
+		return flattenedRegions
+	}
+
 	for _, r := range *regions {
 		flattenedRegions.Add(r)
 	}
@@ -505,17 +533,17 @@ func expandDeploymentDefinition(configmap map[string]interface{}) *koyeb.Deploym
 		Env:           expandEnvs(rawDeploymentDefinition["env"].(*schema.Set).List()),
 		Ports:         expandPorts(rawDeploymentDefinition["ports"].(*schema.Set).List()),
 		Routes:        expandRoutes(rawDeploymentDefinition["routes"].(*schema.Set).List()),
-		Scalings:      expandScalings(rawDeploymentDefinition["scalings"].(*schema.Set).List()),
-		InstanceTypes: expandInstanceTypes(rawDeploymentDefinition["instance_types"].(*schema.Set).List()),
+		Scalings:      expandScalings(rawDeploymentDefinition["scalings"].([]interface{})),
+		InstanceTypes: expandInstanceTypes(rawDeploymentDefinition["instance_types"].([]interface{})),
 		Regions:       expandRegions(rawDeploymentDefinition["regions"].(*schema.Set).List()),
 	}
 
-	git := rawDeploymentDefinition["git"].(*schema.Set).List()
+	git := rawDeploymentDefinition["git"].([]interface{})
 	if len(git) > 0 {
 		deploymentDefinition.Git = expandGitSource(git)
 	}
 
-	docker := rawDeploymentDefinition["docker"].(*schema.Set).List()
+	docker := rawDeploymentDefinition["docker"].([]interface{})
 	if len(docker) > 0 {
 		deploymentDefinition.Docker = expandDockerSource(docker)
 	}
@@ -527,7 +555,7 @@ func flattenDeploymentDefinition(deployment *koyeb.DeploymentDefinition) []inter
 	result := make([]interface{}, 0)
 
 	r := make(map[string]interface{})
-	r["name"] = deployment.Name
+	r["name"] = deployment.GetName()
 	r["docker"] = flattenDocker(deployment.Docker)
 	r["git"] = flattenGit(deployment.Git)
 	r["env"] = flattenEnvs(deployment.Env)
@@ -546,7 +574,7 @@ func deploymentSchema() *schema.Resource {
 	return &schema.Resource{
 		Schema: map[string]*schema.Schema{
 			"definition": {
-				Type:        schema.TypeSet,
+				Type:        schema.TypeList,
 				MinItems:    1,
 				MaxItems:    1,
 				Required:    true,
@@ -624,12 +652,12 @@ func flattenDeployment(deployment *koyeb.Deployment) []interface{} {
 	r["messages"] = strings.Join(deployment.GetMessages(), " ")
 	r["child_id"] = deployment.GetChildId()
 	r["parent_id"] = deployment.GetParentId()
-	r["terminated_at"] = deployment.GetTerminatedAt().UTC().String()
-	r["succeeded_at"] = deployment.GetSucceededAt().UTC().String()
-	r["started_at"] = deployment.GetStartedAt().UTC().String()
-	r["allocated_at"] = deployment.GetAllocatedAt().UTC().String()
-	r["updated_at"] = deployment.GetUpdatedAt().UTC().String()
-	r["created_at"] = deployment.GetCreatedAt().UTC().String()
+	r["terminated_at"] = flattenTime(deployment.GetTerminatedAtOk())
+	r["succeeded_at"] = flattenTime(deployment.GetSucceededAtOk())
+	r["started_at"] = flattenTime(deployment.GetStartedAtOk())
+	r["allocated_at"] = flattenTime(deployment.GetAllocatedAtOk())
+	r["updated_at"] = flattenTime(deployment.GetUpdatedAtOk())
+	r["created_at"] = flattenTime(deployment.GetCreatedAtOk())
 
 	result = append(result, r)
 
@@ -651,17 +679,17 @@ func serviceSchema() map[string]*schema.Schema {
 		"app_name": {
 			Type:         schema.TypeString,
 			Required:     true,
-			ForceNew:     true,
 			Description:  "The app name the service is assigned to",
 			ValidateFunc: validation.StringLenBetween(3, 23),
 		},
 		"app_id": {
 			Type:        schema.TypeString,
+			Optional:    true,
 			Computed:    true,
-			Description: "The app id the service is assigned to",
+			Description: "The app id the service is assigned to. Unlike the app name it does not change when the app is renamed, set it to move the service to an app created in the same apply, which replaces the service",
 		},
 		"definition": {
-			Type:        schema.TypeSet,
+			Type:        schema.TypeList,
 			MinItems:    1,
 			MaxItems:    1,
 			Required:    true,
@@ -738,11 +766,13 @@ func flattenService(service *koyeb.Service) []interface{} {
 	r := make(map[string]interface{})
 	r["id"] = service.GetId()
 	r["name"] = service.GetName()
-	r["paused_at"] = service.GetCreatedAt().UTC().String()
-	r["resumed_at"] = service.GetCreatedAt().UTC().String()
-	r["terminated_at"] = service.GetCreatedAt().UTC().String()
-	r["created_at"] = service.GetCreatedAt().UTC().String()
-	r["updated_at"] = service.GetUpdatedAt().UTC().String()
+	r["paused_at"] = flattenTime(service.GetPausedAtOk())
+	r["resumed_at"] = flattenTime(service.GetResumedAtOk())
+	r["terminated_at"] = flattenTime(service.GetTerminatedAtOk())
+	r["created_at"] = flattenTime(service.GetCreatedAtOk())
+	r["updated_at"] = flattenTime(service.GetUpdatedAtOk())
+
+	result = append(result, r)
 
 	return result
 }
@@ -752,15 +782,397 @@ func resourceKoyebService() *schema.Resource {
 		// This description is used by the documentation generator and the language server.
 		Description: "Service resource in the Koyeb Terraform provider.",
 
+		SchemaVersion: 1,
+		StateUpgraders: []schema.StateUpgrader{
+			{
+				Version: 0,
+				Type:    resourceKoyebServiceV0().CoreConfigSchema().ImpliedType(),
+				Upgrade: resourceKoyebServiceStateUpgradeV0,
+			},
+		},
+
 		CreateContext: resourceKoyebServiceCreate,
 		ReadContext:   resourceKoyebServiceRead,
 		UpdateContext: resourceKoyebServiceUpdate,
 		DeleteContext: resourceKoyebServiceDelete,
 
+		CustomizeDiff: resourceKoyebServiceCustomizeDiff,
+
+		ValidateRawResourceConfigFuncs: []schema.ValidateRawResourceConfigFunc{
+			resourceKoyebServiceValidateDefinition,
+		},
+
 		Schema: serviceSchema(),
 	}
 }
 
+// resourceKoyebServiceV0 is the schema of the service resource before the
+// single element blocks were converted from sets to lists. It is a frozen
+// copy of the shape of the states written at version 0, and must not be
+// derived from the current schema, whose changes would change it too.
+func resourceKoyebServiceV0() *schema.Resource {
+	definition := &schema.Resource{
+		Schema: map[string]*schema.Schema{
+			"name": {Type: schema.TypeString, Required: true},
+			"docker": {
+				Type:     schema.TypeSet,
+				Optional: true,
+				MaxItems: 1,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"image":                 {Type: schema.TypeString, Required: true},
+						"command":               {Type: schema.TypeString, Optional: true},
+						"args":                  {Type: schema.TypeList, Optional: true, Elem: &schema.Schema{Type: schema.TypeString}},
+						"image_registry_secret": {Type: schema.TypeString, Optional: true},
+					},
+				},
+			},
+			"git": {
+				Type:     schema.TypeSet,
+				Optional: true,
+				MaxItems: 1,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"repository":        {Type: schema.TypeString, Required: true},
+						"branch":            {Type: schema.TypeString, Required: true},
+						"build_command":     {Type: schema.TypeString, Optional: true},
+						"run_command":       {Type: schema.TypeString, Optional: true},
+						"no_deploy_on_push": {Type: schema.TypeBool, Optional: true},
+					},
+				},
+			},
+			"env": {
+				Type:     schema.TypeSet,
+				Optional: true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"key":    {Type: schema.TypeString, Required: true},
+						"value":  {Type: schema.TypeString, Optional: true},
+						"secret": {Type: schema.TypeString, Optional: true, Sensitive: true},
+					},
+				},
+			},
+			"ports": {
+				Type:     schema.TypeSet,
+				Required: true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"port":     {Type: schema.TypeInt, Required: true},
+						"protocol": {Type: schema.TypeString, Required: true},
+					},
+				},
+			},
+			"routes": {
+				Type:     schema.TypeSet,
+				Optional: true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"port": {Type: schema.TypeInt, Required: true},
+						"path": {Type: schema.TypeString, Required: true},
+					},
+				},
+			},
+			"instance_types": {
+				Type:     schema.TypeSet,
+				Required: true,
+				MinItems: 1,
+				MaxItems: 1,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"type": {Type: schema.TypeString, Required: true},
+					},
+				},
+			},
+			"scalings": {
+				Type:     schema.TypeSet,
+				Required: true,
+				MinItems: 1,
+				MaxItems: 1,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"min": {Type: schema.TypeInt, Optional: true},
+						"max": {Type: schema.TypeInt, Optional: true},
+					},
+				},
+			},
+			"regions": {Type: schema.TypeSet, Required: true, Elem: &schema.Schema{Type: schema.TypeString}},
+		},
+	}
+
+	return &schema.Resource{
+		Schema: map[string]*schema.Schema{
+			"id":                {Type: schema.TypeString, Computed: true},
+			"name":              {Type: schema.TypeString, Computed: true},
+			"app_name":          {Type: schema.TypeString, Required: true},
+			"app_id":            {Type: schema.TypeString, Computed: true},
+			"definition":        {Type: schema.TypeSet, Required: true, MinItems: 1, MaxItems: 1, Elem: definition},
+			"organization_id":   {Type: schema.TypeString, Computed: true},
+			"active_deployment": {Type: schema.TypeString, Computed: true},
+			"latest_deployment": {Type: schema.TypeString, Computed: true},
+			"version":           {Type: schema.TypeString, Computed: true},
+			"status":            {Type: schema.TypeString, Computed: true},
+			"messages":          {Type: schema.TypeString, Optional: true, Computed: true},
+			"paused_at":         {Type: schema.TypeString, Computed: true},
+			"resumed_at":        {Type: schema.TypeString, Computed: true},
+			"terminated_at":     {Type: schema.TypeString, Computed: true},
+			"updated_at":        {Type: schema.TypeString, Computed: true},
+			"created_at":        {Type: schema.TypeString, Computed: true},
+		},
+	}
+}
+
+// resourceKoyebServiceStateUpgradeV0 migrates the single element sets of the
+// definition to lists. Both are stored as JSON arrays, so the elements only
+// need to be carried over, dropping any extra element a set could hold.
+func resourceKoyebServiceStateUpgradeV0(ctx context.Context, rawState map[string]interface{}, meta interface{}) (map[string]interface{}, error) {
+	if rawState == nil {
+		return rawState, nil
+	}
+
+	rawState["definition"] = firstElement(rawState["definition"])
+
+	for _, rawDefinition := range rawState["definition"].([]interface{}) {
+		definition, ok := rawDefinition.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		for _, name := range []string{"docker", "git", "instance_types", "scalings"} {
+			definition[name] = firstElement(definition[name])
+		}
+	}
+
+	return rawState, nil
+}
+
+// firstElement returns a list holding at most the first element of the raw
+// JSON array value.
+func firstElement(value interface{}) []interface{} {
+	elements, _ := value.([]interface{})
+	if len(elements) > 1 {
+		return elements[:1]
+	}
+
+	return elements
+}
+
+// resourceKoyebServiceCustomizeDiff replaces the service when it is moved to
+// another app, but not when its app is renamed in place. A configured app_id
+// identifies the app across renames. Otherwise the new app name is resolved.
+// A name that can't be resolved yet is the one of an app renamed or created in
+// the same apply, the two can't be told apart when planning. While the current
+// app of the service still exists, it is assumed to be renamed and the update
+// fails if the service was moved instead.
+func resourceKoyebServiceCustomizeDiff(ctx context.Context, d *schema.ResourceDiff, meta interface{}) error {
+	if d.Id() == "" {
+		return nil
+	}
+
+	// The ID of an app created in the same apply is unknown, it must be
+	// kept unknown when forcing the replacement
+	if !d.NewValueKnown("app_id") {
+		if err := d.SetNewComputed("app_id"); err != nil {
+			return err
+		}
+		return d.ForceNew("app_id")
+	}
+
+	if d.HasChange("app_id") {
+		return d.ForceNew("app_id")
+	}
+
+	if !d.HasChange("app_name") || isConfigured(d.GetRawConfig(), "app_id") {
+		return nil
+	}
+
+	if !d.NewValueKnown("app_name") {
+		return d.ForceNew("app_name")
+	}
+
+	client := meta.(*Client)
+
+	appId, err := client.ResolveID(ctx, idKindApp, d.Get("app_name").(string))
+	if err == nil {
+		if appId != d.Get("app_id").(string) {
+			return d.ForceNew("app_name")
+		}
+		return nil
+	}
+
+	oldAppName, newAppName := d.GetChange("app_name")
+	currentAppName, err := client.AppName(ctx, d.Get("app_id").(string))
+	if err != nil {
+		tflog.Debug(ctx, "Cannot read the current app of the service, replacing it", map[string]interface{}{"app_id": d.Get("app_id").(string), "error": err.Error()})
+		return d.ForceNew("app_name")
+	}
+
+	if currentAppName != oldAppName.(string) && currentAppName != newAppName.(string) {
+		return d.ForceNew("app_name")
+	}
+
+	tflog.Debug(ctx, "Cannot resolve the new app of the service yet, assuming its app is renamed", map[string]interface{}{"app_name": newAppName.(string), "app_id": d.Get("app_id").(string)})
+	return nil
+}
+
+// isConfigured reports whether the attribute is set in the raw configuration,
+// unknown values are set.
+func isConfigured(config cty.Value, name string) bool {
+	if config.IsNull() || !config.IsKnown() {
+		return false
+	}
+
+	return !config.GetAttr(name).IsNull()
+}
+
+// resourceKoyebServiceValidateDefinition reports the definitions the API
+// would reject once the apply started, with one diagnostic per problem. Values
+// unknown at validation time are skipped, the API checks them.
+func resourceKoyebServiceValidateDefinition(ctx context.Context, req schema.ValidateResourceConfigFuncRequest, resp *schema.ValidateResourceConfigFuncResponse) {
+	resp.Diagnostics = append(resp.Diagnostics, validateServiceDefinitions(req.RawConfig)...)
+}
+
+func validateServiceDefinitions(config cty.Value) diag.Diagnostics {
+	if config.IsNull() || !config.IsKnown() {
+		return nil
+	}
+
+	definitions, _ := configBlocks(config.GetAttr("definition"))
+
+	var diags diag.Diagnostics
+	for i, definition := range definitions {
+		diags = append(diags, validateServiceDefinition(cty.GetAttrPath("definition").IndexInt(i), definition)...)
+	}
+
+	return diags
+}
+
+// validateServiceDefinition checks the definition at path. env, ports and
+// routes are sets, so their diagnostics point at the whole block since their
+// elements have no index.
+func validateServiceDefinition(path cty.Path, definition cty.Value) diag.Diagnostics {
+	var diags diag.Diagnostics
+	invalid := func(path cty.Path, summary string, detail string, args ...interface{}) {
+		diags = append(diags, diag.Diagnostic{
+			Severity:      diag.Error,
+			Summary:       summary,
+			Detail:        fmt.Sprintf(detail, args...),
+			AttributePath: path,
+		})
+	}
+
+	docker, dockerKnown := configBlocks(definition.GetAttr("docker"))
+	git, gitKnown := configBlocks(definition.GetAttr("git"))
+	if dockerKnown && gitKnown {
+		if len(docker) > 0 && len(git) > 0 {
+			invalid(path.GetAttr("git"), "Conflicting service sources", "Only one of docker or git can be set.")
+		}
+		if len(docker) == 0 && len(git) == 0 {
+			invalid(path, "Missing service source", "One of docker or git must be set.")
+		}
+	}
+
+	ports, portsKnown := configBlocks(definition.GetAttr("ports"))
+	declaredPorts := map[int64]bool{}
+	for _, port := range ports {
+		number, ok := configInt(port, "port")
+		if !ok {
+			portsKnown = false
+			continue
+		}
+		declaredPorts[number] = true
+	}
+
+	routes, _ := configBlocks(definition.GetAttr("routes"))
+	routedPaths := map[string]bool{}
+	for _, route := range routes {
+		routePath, pathKnown := configString(route, "path")
+		if pathKnown {
+			if routedPaths[routePath] {
+				invalid(path.GetAttr("routes"), "Duplicate route path", "The path %q is routed more than once.", routePath)
+			}
+			routedPaths[routePath] = true
+		}
+
+		if port, ok := configInt(route, "port"); ok && portsKnown && !declaredPorts[port] {
+			invalid(path.GetAttr("routes"), "Undeclared route port", "The route of the path %q uses the port %d, which is not declared in ports.", routePath, port)
+		}
+	}
+
+	scalings, _ := configBlocks(definition.GetAttr("scalings"))
+	for i, scaling := range scalings {
+		scalingMin, minKnown := configInt(scaling, "min")
+		scalingMax, maxKnown := configInt(scaling, "max")
+		if minKnown && maxKnown && scalingMin > scalingMax {
+			invalid(path.GetAttr("scalings").IndexInt(i).GetAttr("min"), "Invalid scaling", "min %d is greater than max %d.", scalingMin, scalingMax)
+		}
+	}
+
+	envs, _ := configBlocks(definition.GetAttr("env"))
+	keys := map[string]bool{}
+	for _, env := range envs {
+		key, ok := configString(env, "key")
+		if !ok {
+			continue
+		}
+
+		if keys[key] {
+			invalid(path.GetAttr("env"), "Duplicate environment variable", "The variable %s is defined more than once.", key)
+		}
+		keys[key] = true
+
+		value, _ := configString(env, "value")
+		secret, _ := configString(env, "secret")
+		if value != "" && secret != "" {
+			invalid(path.GetAttr("env"), "Conflicting environment variable values", "The variable %s sets both value and secret.", key)
+		}
+	}
+
+	return diags
+}
+
+// configBlocks returns the elements of a nested block of the raw
+// configuration, and false when the blocks are unknown, e.g. when generated
+// by a dynamic block iterating over an unknown value.
+func configBlocks(value cty.Value) ([]cty.Value, bool) {
+	if !value.IsKnown() {
+		return nil, false
+	}
+	if value.IsNull() {
+		return nil, true
+	}
+
+	blocks := []cty.Value{}
+	for _, block := range value.AsValueSlice() {
+		if !block.IsKnown() || block.IsNull() {
+			return nil, false
+		}
+		blocks = append(blocks, block)
+	}
+
+	return blocks, true
+}
+
+// configString returns the attribute of a block of the raw configuration, and
+// false when it is unknown or not set.
+func configString(block cty.Value, name string) (string, bool) {
+	value := block.GetAttr(name)
+	if !value.IsKnown() || value.IsNull() {
+		return "", false
+	}
+
+	return value.AsString(), true
+}
+
+func configInt(block cty.Value, name string) (int64, bool) {
+	value := block.GetAttr(name)
+	if !value.IsKnown() || value.IsNull() {
+		return 0, false
+	}
+
+	number, _ := value.AsBigFloat().Int64()
+	return number, true
+}
+
 func setServiceAttribute(
 	d *schema.ResourceData,
 	service *koyeb.Service,
@@ -774,11 +1186,11 @@ func setServiceAttribute(
 	d.Set("version", service.GetVersion())
 	d.Set("status", service.GetStatus())
 	d.Set("messages", strings.Join(service.GetMessages(), " "))
-	d.Set("paused_at", service.GetPausedAt().UTC().String())
-	d.Set("resumed_at", service.GetResumedAt().UTC().String())
-	d.Set("terminated_at", service.GetTerminatedAt().UTC().String())
-	d.Set("created_at", service.GetCreatedAt().UTC().String())
-	d.Set("updated_at", service.GetUpdatedAt().UTC().String())
+	d.Set("paused_at", flattenTime(service.GetPausedAtOk()))
+	d.Set("resumed_at", flattenTime(service.GetResumedAtOk()))
+	d.Set("terminated_at", flattenTime(service.GetTerminatedAtOk()))
+	d.Set("created_at", flattenTime(service.GetCreatedAtOk()))
+	d.Set("updated_at", flattenTime(service.GetUpdatedAtOk()))
 	d.Set("latest_deployment", service.GetLatestDeploymentId())
 	d.Set("active_deployment", service.GetActiveDeploymentId())
 	d.Set("organization_id", service.GetOrganizationId())
@@ -794,14 +1206,32 @@ func setServiceAttribute(
 	return nil
 }
 
+func serviceStatusWaiter(client *Client, id string) statusWaiter[koyeb.GetServiceReply] {
+	return statusWaiter[koyeb.GetServiceReply]{
+		Resource: fmt.Sprintf("service %s", id),
+		Refresh: func(ctx context.Context) (koyeb.GetServiceReply, *http.Response, error) {
+			return client.ServicesApi.GetService(ctx, id).Execute()
+		},
+		Status: func(res koyeb.GetServiceReply) string {
+			return string(res.Service.GetStatus())
+		},
+		Messages: func(res koyeb.GetServiceReply) []string {
+			return res.Service.GetMessages()
+		},
+	}
+}
+
+// serviceSlug returns the "<app name>/<service name>" slug identifying a service.
+func serviceSlug(appName string, serviceName string) string {
+	return appName + "/" + serviceName
+}
+
 func resourceKoyebServiceCreate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
-	client := meta.(*koyeb.APIClient)
-	mapper := idmapper.NewMapper(context.Background(), client)
-	appMapper := mapper.App()
+	client := meta.(*Client)
 	var appId string
 
 	if d.Get("app_name").(string) != "" {
-		id, err := appMapper.ResolveID(d.Get("app_name").(string))
+		id, err := client.ResolveID(ctx, idKindApp, d.Get("app_name").(string))
 
 		if err != nil {
 			return diag.Errorf("Error creating service: %s", err)
@@ -810,37 +1240,43 @@ func resourceKoyebServiceCreate(ctx context.Context, d *schema.ResourceData, met
 		appId = id
 	}
 
-	definition := expandDeploymentDefinition(d.Get("definition").(*schema.Set).List()[0].(map[string]interface{}))
+	if configuredAppId := d.Get("app_id").(string); configuredAppId != "" && configuredAppId != appId {
+		return diag.Errorf("Error creating service: app_id %s is not the ID of app %s", configuredAppId, d.Get("app_name").(string))
+	}
+
+	definition := expandDeploymentDefinition(d.Get("definition").([]interface{})[0].(map[string]interface{}))
 
-	res, resp, err := client.ServicesApi.CreateService(context.Background()).Body(koyeb.CreateService{
+	res, _, err := client.ServicesApi.CreateService(ctx).Body(koyeb.CreateService{
 		AppId:      &appId,
 		Definition: definition,
 	}).Execute()
 	if err != nil {
-		return diag.Errorf("Error creating service: %s (%v %v)", err, resp, res)
+		return apiErrorDiagnostics("Error creating service", err, serviceSchema())
 	}
 
 	d.SetId(*res.Service.Id)
-	log.Printf("[INFO] Created service name: %s", *res.Service.Name)
+	tflog.Info(ctx, "Created service", map[string]interface{}{"name": res.Service.GetName(), "id": res.Service.GetId()})
+	client.ids.set(idKindService, serviceSlug(d.Get("app_name").(string), res.Service.GetName()), res.Service.GetId())
+	client.secretUsage.forget()
 
 	return resourceKoyebServiceRead(ctx, d, meta)
 }
 
 func resourceKoyebServiceRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
-	client := meta.(*koyeb.APIClient)
+	client := meta.(*Client)
 	// var activeDeployment *koyeb.Deployment
 	// var latestDeployment *koyeb.Deployment
 
-	res, resp, err := client.ServicesApi.GetService(context.Background(), d.Id()).Execute()
+	res, resp, err := client.ServicesApi.GetService(ctx, d.Id()).Execute()
 	if err != nil {
 		// If the service is somehow already destroyed, mark as
 		// successfully gone
-		if resp.StatusCode == 404 {
+		if resp != nil && resp.StatusCode == 404 {
 			d.SetId("")
 			return nil
 		}
 
-		return diag.Errorf("Error retrieving service: %s (%v %v)", err, resp, res)
+		return apiErrorDiagnostics("Error retrieving service", err, serviceSchema())
 	}
 
 	// if activeDeploymentId, ok := res.Service.GetActiveDeploymentIdOk(); ok {
@@ -871,32 +1307,53 @@ func resourceKoyebServiceRead(ctx context.Context, d *schema.ResourceData, meta
 }
 
 func resourceKoyebServiceUpdate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
-	client := meta.(*koyeb.APIClient)
+	client := meta.(*Client)
+
+	if d.HasChange("app_name") {
+		appId, err := client.ResolveID(ctx, idKindApp, d.Get("app_name").(string))
+		if err != nil {
+			return diag.Errorf("Error updating service: %s", err)
+		}
 
-	definition := expandDeploymentDefinition(d.Get("definition").(*schema.Set).List()[0].(map[string]interface{}))
+		if appId != d.Get("app_id").(string) {
+			return diag.Errorf("Error updating service: app %s is not the app the service is assigned to, the service must be replaced to move it to another app, set app_id to the ID of the new app to replace it", d.Get("app_name").(string))
+		}
+	}
+
+	if !d.HasChange("definition") {
+		return resourceKoyebServiceRead(ctx, d, meta)
+	}
+
+	definition := expandDeploymentDefinition(d.Get("definition").([]interface{})[0].(map[string]interface{}))
 
-	res, resp, err := client.ServicesApi.UpdateService(context.Background(), d.Id()).Body(koyeb.UpdateService{
+	res, _, err := client.ServicesApi.UpdateService(ctx, d.Id()).Body(koyeb.UpdateService{
 		Definition: definition,
 	}).Execute()
 
 	if err != nil {
-		return diag.Errorf("Error updating service: %s (%v %v)", err, resp, res)
+		return apiErrorDiagnostics("Error updating service", err, serviceSchema())
 	}
 
-	log.Printf("[INFO] Updated service name: %s", *res.Service.Name)
+	tflog.Info(ctx, "Updated service", map[string]interface{}{"name": res.Service.GetName()})
+	oldAppName, _ := d.GetChange("app_name")
+	client.ids.forget(idKindService, serviceSlug(oldAppName.(string), d.Get("name").(string)))
+	client.secretUsage.forget()
 	return resourceKoyebServiceRead(ctx, d, meta)
 
 }
 
 func resourceKoyebServiceDelete(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
-	client := meta.(*koyeb.APIClient)
+	client := meta.(*Client)
 
-	res, resp, err := client.ServicesApi.DeleteService(context.Background(), d.Id()).Execute()
+	_, _, err := client.ServicesApi.DeleteService(ctx, d.Id()).Execute()
 
 	if err != nil {
-		return diag.Errorf("Error deleting service: %s (%v %v)", err, resp, res)
+		return apiErrorDiagnostics("Error deleting service", err, serviceSchema())
 	}
 
+	client.ids.forget(idKindService, serviceSlug(d.Get("app_name").(string), d.Get("name").(string)))
+	client.secretUsage.forget()
+
 	d.SetId("")
 	return nil
 }
@@ -2,49 +2,796 @@ package koyeb
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
-	"log"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/hashicorp/go-cty/cty"
+	ctyjson "github.com/hashicorp/go-cty/cty/json"
+	"github.com/hashicorp/go-cty/cty/msgpack"
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/terraform-plugin-go/tfprotov5"
+	"github.com/hashicorp/terraform-plugin-go/tftypes"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
 	"github.com/koyeb/koyeb-api-client-go/api/v1/koyeb"
 )
 
 func init() {
 	resource.AddTestSweepers("koyeb_service", &resource.Sweeper{
-		Name:         "koyeb_service",
-		F:            testSweepService,
-		Dependencies: []string{"koyeb_app"},
+		Name: "koyeb_service",
+		F:    testSweepService,
+	})
+
+	resource.AddTestSweepers("koyeb_deployment", &resource.Sweeper{
+		Name:         "koyeb_deployment",
+		F:            testSweepDeployment,
+		Dependencies: []string{"koyeb_service"},
 	})
 
 }
 
+// testSweepService deletes the services of the test apps, which are all
+// named after the app, and waits until they are deleted.
 func testSweepService(string) error {
 	meta, err := sharedConfig()
 	if err != nil {
 		return err
 	}
 
-	client := meta.(*koyeb.APIClient)
+	client := meta.(*Client)
+	ctx := context.Background()
+
+	apps, err := sweepApps(ctx, client)
+	if err != nil {
+		return err
+	}
+
+	services, err := client.ListServices(ctx, "")
+	if err != nil {
+		return fmt.Errorf("error listing services: %w", err)
+	}
+
+	sweep := map[string]string{}
+	for _, s := range services {
+		if !isTestName(apps[s.GetAppId()]) && !isTestName(s.GetName()) {
+			continue
+		}
+		if s.GetStatus() == koyeb.SERVICESTATUS_DELETED {
+			continue
+		}
+
+		sweep[s.GetId()] = serviceSlug(apps[s.GetAppId()], s.GetName())
+	}
+
+	return sweepDeleteServices(ctx, client, sweep)
+}
 
-	res, _, err := client.ServicesApi.ListServices(context.Background()).Limit("100").Execute()
+// testSweepDeployment sweeps the deployments of the test apps still running
+// after their services were swept. The API cannot delete a deployment, so
+// the services of the dangling deployments are deleted again, and the ones
+// left running by a deleted service are reported.
+func testSweepDeployment(string) error {
+	meta, err := sharedConfig()
 	if err != nil {
 		return err
 	}
 
-	for _, a := range *res.Services {
-		if strings.HasPrefix(a.GetName(), testNamePrefix) {
-			log.Printf("Destroying service %s", *a.Name)
+	client := meta.(*Client)
+	ctx := context.Background()
 
-			if _, _, err := client.ServicesApi.DeleteService(context.Background(), a.GetId()).Execute(); err != nil {
-				return err
+	apps, err := sweepApps(ctx, client)
+	if err != nil {
+		return err
+	}
+
+	deployments, err := sweepList(func(limit string, offset string) ([]koyeb.DeploymentListItem, int64, error) {
+		res, _, err := client.DeploymentsApi.ListDeployments(ctx).Limit(limit).Offset(offset).Execute()
+		return res.GetDeployments(), res.GetCount(), err
+	})
+	if err != nil {
+		return fmt.Errorf("error listing deployments: %w", err)
+	}
+
+	var result *multierror.Error
+	sweep := map[string]string{}
+
+	for _, d := range deployments {
+		if !isTestName(apps[d.GetAppId()]) {
+			continue
+		}
+
+		switch d.GetStatus() {
+		case koyeb.DEPLOYMENTSTATUS_CANCELED, koyeb.DEPLOYMENTSTATUS_STOPPED, koyeb.DEPLOYMENTSTATUS_ERROR:
+			continue
+		}
+
+		res, resp, err := client.ServicesApi.GetService(ctx, d.GetServiceId()).Execute()
+		if err != nil && !sweepNotFound(resp) {
+			result = multierror.Append(result, fmt.Errorf("error retrieving service of deployment %s: %w", d.GetId(), err))
+			continue
+		}
+
+		if err != nil || res.Service.GetStatus() == koyeb.SERVICESTATUS_DELETED {
+			result = multierror.Append(result, fmt.Errorf("deployment %s of app %s is %s but its service is deleted", d.GetId(), apps[d.GetAppId()], d.GetStatus()))
+			continue
+		}
+
+		sweep[d.GetServiceId()] = serviceSlug(apps[d.GetAppId()], res.Service.GetName())
+	}
+
+	if err := sweepDeleteServices(ctx, client, sweep); err != nil {
+		result = multierror.Append(result, err)
+	}
+
+	return result.ErrorOrNil()
+}
+
+func TestResourceKoyebServiceStateUpgradeV0(t *testing.T) {
+	state := testUpgradeResourceState(t, "koyeb_service", 0, `{
+		"id": "service-id",
+		"app_name": "app",
+		"definition": [{
+			"name": "main",
+			"docker": [{"image": "koyeb/demo", "command": "", "args": [], "image_registry_secret": ""}],
+			"git": [],
+			"env": [{"key": "FOO", "value": "BAR", "secret": ""}],
+			"ports": [{"port": 3000, "protocol": "http"}],
+			"routes": [{"path": "/", "port": 3000}],
+			"instance_types": [{"type": "micro"}],
+			"scalings": [{"min": 1, "max": 2}],
+			"regions": ["par"]
+		}]
+	}`)
+
+	for path, expected := range map[string]tftypes.Value{
+		"definition.0.name":                  tftypes.NewValue(tftypes.String, "main"),
+		"definition.0.docker.0.image":        tftypes.NewValue(tftypes.String, "koyeb/demo"),
+		"definition.0.instance_types.0.type": tftypes.NewValue(tftypes.String, "micro"),
+		"definition.0.scalings.0.max":        tftypes.NewValue(tftypes.Number, 2),
+	} {
+		if value := testStateAttribute(t, state, path); !value.Equal(expected) {
+			t.Errorf("expected %s to be %s, got %s", path, expected, value)
+		}
+	}
+
+	for _, path := range []string{"definition", "definition.0.docker", "definition.0.git", "definition.0.instance_types", "definition.0.scalings"} {
+		if value := testStateAttribute(t, state, path); !isListType(value.Type()) {
+			t.Errorf("expected %s to be a list, got %s", path, value.Type())
+		}
+	}
+}
+
+func TestResourceKoyebServiceStateUpgradeV0_Fixture(t *testing.T) {
+	rawState := testStateFixture(t, "koyeb_service_v0", resourceKoyebServiceV0().CoreConfigSchema().ImpliedType())
+	state := testUpgradeResourceState(t, "koyeb_service", 0, rawState)
+
+	for path, expected := range map[string]tftypes.Value{
+		"app_name":                           tftypes.NewValue(tftypes.String, "app"),
+		"definition.0.docker.0.image":        tftypes.NewValue(tftypes.String, "koyeb/demo"),
+		"definition.0.instance_types.0.type": tftypes.NewValue(tftypes.String, "micro"),
+		"definition.0.scalings.0.min":        tftypes.NewValue(tftypes.Number, 1),
+		"definition.0.scalings.0.max":        tftypes.NewValue(tftypes.Number, 2),
+	} {
+		if value := testStateAttribute(t, state, path); !value.Equal(expected) {
+			t.Errorf("expected %s to be %s, got %s", path, expected, value)
+		}
+	}
+
+	var env []tftypes.Value
+	if err := testStateAttribute(t, state, "definition.0.env").As(&env); err != nil || len(env) != 2 {
+		t.Errorf("expected the two environment variables, got %v (%v)", env, err)
+	}
+}
+
+// testRoundTripDefinition flattens definition in a service state and expands
+// it back, the way a definition read from the API is planned against.
+func testRoundTripDefinition(t *testing.T, definition *koyeb.DeploymentDefinition) *koyeb.DeploymentDefinition {
+	d := schema.TestResourceDataRaw(t, serviceSchema(), map[string]interface{}{})
+	if err := d.Set("definition", flattenDeploymentDefinition(definition)); err != nil {
+		t.Fatalf("cannot set the flattened definition: %s", err)
+	}
+
+	return expandDeploymentDefinition(d.Get("definition").([]interface{})[0].(map[string]interface{}))
+}
+
+func TestDeploymentDefinition_RoundTrip(t *testing.T) {
+	base := func(source string, block map[string]interface{}) map[string]interface{} {
+		return map[string]interface{}{
+			"name":           "main",
+			source:           []interface{}{block},
+			"ports":          []interface{}{map[string]interface{}{"port": 3000, "protocol": "http"}},
+			"routes":         []interface{}{map[string]interface{}{"path": "/", "port": 3000}},
+			"instance_types": []interface{}{map[string]interface{}{"type": "micro"}},
+			"scalings":       []interface{}{map[string]interface{}{"min": 1, "max": 2}},
+			"regions":        []interface{}{"par"},
+		}
+	}
+
+	multiple := base("docker", map[string]interface{}{"image": "koyeb/demo"})
+	multiple["env"] = []interface{}{
+		map[string]interface{}{"key": "FOO", "value": "bar"},
+		map[string]interface{}{"key": "TOKEN", "secret": "token"},
+	}
+	multiple["ports"] = []interface{}{
+		map[string]interface{}{"port": 3000, "protocol": "http"},
+		map[string]interface{}{"port": 4000, "protocol": "tcp"},
+	}
+	multiple["routes"] = []interface{}{
+		map[string]interface{}{"path": "/", "port": 3000},
+		map[string]interface{}{"path": "/api", "port": 3000},
+	}
+	multiple["regions"] = []interface{}{"par", "fra"}
+
+	cases := []struct {
+		name   string
+		config map[string]interface{}
+		check  func(*testing.T, *koyeb.DeploymentDefinition)
+	}{
+		{
+			"docker without command",
+			base("docker", map[string]interface{}{"image": "koyeb/demo"}),
+			func(t *testing.T, definition *koyeb.DeploymentDefinition) {
+				if definition.Docker.Command != nil || definition.Docker.ImageRegistrySecret != nil {
+					t.Errorf("expected the unset docker attributes to be omitted, got %+v", definition.Docker)
+				}
+				if definition.Git != nil {
+					t.Errorf("expected no git source, got %+v", definition.Git)
+				}
+			},
+		},
+		{
+			"docker with command",
+			base("docker", map[string]interface{}{
+				"image":                 "koyeb/demo",
+				"command":               "/bin/server",
+				"args":                  []interface{}{"--port", "3000"},
+				"image_registry_secret": "registry",
+			}),
+			func(t *testing.T, definition *koyeb.DeploymentDefinition) {
+				if definition.Docker.GetCommand() != "/bin/server" || len(definition.Docker.GetArgs()) != 2 || definition.Docker.GetImageRegistrySecret() != "registry" {
+					t.Errorf("unexpected docker source %+v", definition.Docker)
+				}
+			},
+		},
+		{
+			"git without run command",
+			base("git", map[string]interface{}{
+				"repository":    "github.com/koyeb/example",
+				"branch":        "main",
+				"build_command": "make",
+			}),
+			func(t *testing.T, definition *koyeb.DeploymentDefinition) {
+				if definition.Git.GetBuildCommand() != "make" || definition.Git.RunCommand != nil {
+					t.Errorf("unexpected git source %+v", definition.Git)
+				}
+				if definition.Docker != nil {
+					t.Errorf("expected no docker source, got %+v", definition.Docker)
+				}
+			},
+		},
+		{
+			"multiple elements",
+			multiple,
+			func(t *testing.T, definition *koyeb.DeploymentDefinition) {
+				if len(definition.GetEnv()) != 2 || len(definition.GetPorts()) != 2 || len(definition.GetRoutes()) != 2 || len(definition.GetRegions()) != 2 {
+					t.Errorf("unexpected definition %+v", definition)
+				}
+				for _, env := range definition.GetEnv() {
+					if env.Value != nil && env.Secret != nil {
+						t.Errorf("expected either a value or a secret, got %+v", env)
+					}
+				}
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			d := schema.TestResourceDataRaw(t, serviceSchema(), map[string]interface{}{
+				"app_name":   "app",
+				"definition": []interface{}{c.config},
+			})
+
+			definition := expandDeploymentDefinition(d.Get("definition").([]interface{})[0].(map[string]interface{}))
+			c.check(t, definition)
+
+			if roundTripped := testRoundTripDefinition(t, definition); !reflect.DeepEqual(definition, roundTripped) {
+				t.Errorf("expected the definition to survive a round trip\n got: %+v\nwant: %+v", roundTripped, definition)
 			}
+		})
+	}
+}
+
+// FuzzDeploymentDefinition_RoundTrip flattens arbitrary definitions returned
+// by the API, which must be stable once expanded.
+func FuzzDeploymentDefinition_RoundTrip(f *testing.F) {
+	f.Add([]byte(`{"name": "main", "docker": {"image": "koyeb/demo"}, "ports": [{"port": 3000, "protocol": "http"}], "routes": [{"path": "/", "port": 3000}], "regions": ["par"]}`))
+	f.Add([]byte(`{"name": "main", "git": {"repository": "github.com/koyeb/example", "branch": "main"}, "env": [{"key": "FOO", "value": ""}, {"key": "BAR", "secret": "bar"}]}`))
+	f.Add([]byte(`{"scalings": [{"min": 1}], "instance_types": [{}], "env": [{}], "ports": [{}], "routes": [{}]}`))
+	f.Add([]byte(`{}`))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var definition koyeb.DeploymentDefinition
+		if err := json.Unmarshal(data, &definition); err != nil {
+			return
+		}
+
+		once := testRoundTripDefinition(t, &definition)
+		twice := testRoundTripDefinition(t, once)
+
+		if !reflect.DeepEqual(once, twice) {
+			t.Errorf("expected the definition to be stable\n got: %+v\nwant: %+v", twice, once)
 		}
+	})
+}
+
+func isListType(typ tftypes.Type) bool {
+	_, ok := typ.(tftypes.List)
+	return ok
+}
+
+func TestExpandEnvs(t *testing.T) {
+	cases := []struct {
+		name   string
+		config []interface{}
+		want   []koyeb.DeploymentEnv
+	}{
+		{"nil", nil, []koyeb.DeploymentEnv{}},
+		{"empty", []interface{}{}, []koyeb.DeploymentEnv{}},
+		{
+			"value",
+			[]interface{}{map[string]interface{}{"key": "FOO", "value": "bar", "secret": ""}},
+			[]koyeb.DeploymentEnv{{Key: toOpt("FOO"), Value: toOpt("bar")}},
+		},
+		{
+			"secret",
+			[]interface{}{map[string]interface{}{"key": "TOKEN", "value": "", "secret": "token"}},
+			[]koyeb.DeploymentEnv{{Key: toOpt("TOKEN"), Secret: toOpt("token")}},
+		},
+		{
+			"missing value and secret",
+			[]interface{}{map[string]interface{}{"key": "EMPTY"}},
+			[]koyeb.DeploymentEnv{{Key: toOpt("EMPTY")}},
+		},
 	}
 
-	return nil
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := *expandEnvs(c.config); !reflect.DeepEqual(got, c.want) {
+				t.Errorf("got %+v, want %+v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestExpandPorts(t *testing.T) {
+	cases := []struct {
+		name   string
+		config []interface{}
+		want   []koyeb.DeploymentPort
+	}{
+		{"nil", nil, []koyeb.DeploymentPort{}},
+		{"empty", []interface{}{}, []koyeb.DeploymentPort{}},
+		{
+			"multiple",
+			[]interface{}{
+				map[string]interface{}{"port": 3000, "protocol": "http"},
+				map[string]interface{}{"port": 4000, "protocol": "tcp"},
+			},
+			[]koyeb.DeploymentPort{
+				{Port: toOpt(int64(3000)), Protocol: toOpt("http")},
+				{Port: toOpt(int64(4000)), Protocol: toOpt("tcp")},
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := *expandPorts(c.config); !reflect.DeepEqual(got, c.want) {
+				t.Errorf("got %+v, want %+v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestExpandRoutes(t *testing.T) {
+	cases := []struct {
+		name   string
+		config []interface{}
+		want   []koyeb.DeploymentRoute
+	}{
+		{"nil", nil, []koyeb.DeploymentRoute{}},
+		{"empty", []interface{}{}, []koyeb.DeploymentRoute{}},
+		{
+			"multiple",
+			[]interface{}{
+				map[string]interface{}{"path": "/", "port": 3000},
+				map[string]interface{}{"path": "/api", "port": 4000},
+			},
+			[]koyeb.DeploymentRoute{
+				{Path: toOpt("/"), Port: toOpt(int64(3000))},
+				{Path: toOpt("/api"), Port: toOpt(int64(4000))},
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := *expandRoutes(c.config); !reflect.DeepEqual(got, c.want) {
+				t.Errorf("got %+v, want %+v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestExpandScalings(t *testing.T) {
+	cases := []struct {
+		name   string
+		config []interface{}
+		want   []koyeb.DeploymentScaling
+	}{
+		{"nil", nil, []koyeb.DeploymentScaling{}},
+		{"empty", []interface{}{}, []koyeb.DeploymentScaling{}},
+		{
+			"min and max",
+			[]interface{}{map[string]interface{}{"min": 1, "max": 3}},
+			[]koyeb.DeploymentScaling{{Min: toOpt(int64(1)), Max: toOpt(int64(3))}},
+		},
+		{
+			"scaled to zero",
+			[]interface{}{map[string]interface{}{"min": 0, "max": 0}},
+			[]koyeb.DeploymentScaling{{Min: toOpt(int64(0)), Max: toOpt(int64(0))}},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := *expandScalings(c.config); !reflect.DeepEqual(got, c.want) {
+				t.Errorf("got %+v, want %+v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestExpandDockerSource(t *testing.T) {
+	cases := []struct {
+		name   string
+		config map[string]interface{}
+		want   *koyeb.DockerSource
+	}{
+		{
+			"image only",
+			map[string]interface{}{"image": "koyeb/demo", "args": []interface{}{}},
+			&koyeb.DockerSource{Image: toOpt("koyeb/demo"), Args: toOpt([]string{})},
+		},
+		{
+			"empty command and secret",
+			map[string]interface{}{"image": "koyeb/demo", "command": "", "args": []interface{}{}, "image_registry_secret": ""},
+			&koyeb.DockerSource{Image: toOpt("koyeb/demo"), Args: toOpt([]string{})},
+		},
+		{
+			"command, args and secret",
+			map[string]interface{}{
+				"image":                 "koyeb/demo",
+				"command":               "/bin/server",
+				"args":                  []interface{}{"--port", "3000"},
+				"image_registry_secret": "registry",
+			},
+			&koyeb.DockerSource{
+				Image:               toOpt("koyeb/demo"),
+				Command:             toOpt("/bin/server"),
+				Args:                toOpt([]string{"--port", "3000"}),
+				ImageRegistrySecret: toOpt("registry"),
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := expandDockerSource([]interface{}{c.config}); !reflect.DeepEqual(got, c.want) {
+				t.Errorf("got %+v, want %+v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestExpandGitSource(t *testing.T) {
+	cases := []struct {
+		name   string
+		config map[string]interface{}
+		want   *koyeb.GitSource
+	}{
+		{
+			"repository and branch",
+			map[string]interface{}{"repository": "github.com/koyeb/example", "branch": "main", "no_deploy_on_push": false},
+			&koyeb.GitSource{Repository: toOpt("github.com/koyeb/example"), Branch: toOpt("main"), NoDeployOnPush: toOpt(false)},
+		},
+		{
+			"empty commands",
+			map[string]interface{}{"repository": "github.com/koyeb/example", "branch": "main", "build_command": "", "run_command": "", "no_deploy_on_push": true},
+			&koyeb.GitSource{Repository: toOpt("github.com/koyeb/example"), Branch: toOpt("main"), NoDeployOnPush: toOpt(true)},
+		},
+		{
+			"build and run commands",
+			map[string]interface{}{"repository": "github.com/koyeb/example", "branch": "main", "build_command": "make", "run_command": "./server", "no_deploy_on_push": false},
+			&koyeb.GitSource{
+				Repository:     toOpt("github.com/koyeb/example"),
+				Branch:         toOpt("main"),
+				BuildCommand:   toOpt("make"),
+				RunCommand:     toOpt("./server"),
+				NoDeployOnPush: toOpt(false),
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := expandGitSource([]interface{}{c.config}); !reflect.DeepEqual(got, c.want) {
+				t.Errorf("got %+v, want %+v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestFlattenDeploymentDefinition_Nil(t *testing.T) {
+	cases := map[string]int{
+		"env":            len(flattenEnvs(nil)),
+		"ports":          len(flattenPorts(nil)),
+		"routes":         len(flattenRoutes(nil)),
+		"instance_types": len(flattenInstanceTypes(nil)),
+		"scalings":       len(flattenScalings(nil)),
+		"docker":         len(flattenDocker(nil)),
+		"git":            len(flattenGit(nil)),
+		"regions":        flattenRegions(nil).Len(),
+	}
+
+	for name, length := range cases {
+		if length != 0 {
+			t.Errorf("expected no %s, got %d", name, length)
+		}
+	}
+}
+
+func TestResourceKoyebServiceValidateDefinition(t *testing.T) {
+	configType := resourceKoyebService().CoreConfigSchema().ImpliedType()
+	config := func(definition string) cty.Value {
+		value, err := ctyjson.Unmarshal([]byte(`{"app_name": "app", "definition": [`+definition+`]}`), configType)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		return value
+	}
+	unknown := func(value cty.Value, attribute string) cty.Value {
+		value, _ = cty.Transform(value, func(path cty.Path, v cty.Value) (cty.Value, error) {
+			if len(path) == 0 {
+				return v, nil
+			}
+			if step, ok := path[len(path)-1].(cty.GetAttrStep); ok && step.Name == attribute {
+				return cty.UnknownVal(v.Type()), nil
+			}
+			return v, nil
+		})
+		return value
+	}
+
+	valid := `{
+		"name": "main",
+		"docker": [{"image": "koyeb/demo"}],
+		"env": [{"key": "FOO", "value": "bar"}, {"key": "TOKEN", "secret": "token"}],
+		"ports": [{"port": 3000, "protocol": "http"}, {"port": 4000, "protocol": "http"}],
+		"routes": [{"path": "/", "port": 3000}, {"path": "/api", "port": 4000}],
+		"instance_types": [{"type": "micro"}],
+		"scalings": [{"min": 1, "max": 2}],
+		"regions": ["par"]
+	}`
+
+	definition := cty.GetAttrPath("definition").IndexInt(0)
+	type expectedDiagnostic struct {
+		path   cty.Path
+		detail string
+	}
+
+	cases := []struct {
+		name     string
+		config   cty.Value
+		expected []expectedDiagnostic
+	}{
+		{name: "valid", config: config(valid)},
+		{
+			name:     "docker and git",
+			config:   config(strings.Replace(valid, `"name": "main",`, `"name": "main", "git": [{"repository": "github.com/koyeb/demo", "branch": "main"}],`, 1)),
+			expected: []expectedDiagnostic{{definition.GetAttr("git"), "Only one of docker or git can be set."}},
+		},
+		{
+			name:     "no source",
+			config:   config(strings.Replace(valid, `"docker": [{"image": "koyeb/demo"}],`, ``, 1)),
+			expected: []expectedDiagnostic{{definition, "One of docker or git must be set."}},
+		},
+		{
+			name:     "undeclared route port",
+			config:   config(strings.Replace(valid, `{"path": "/api", "port": 4000}`, `{"path": "/api", "port": 5000}`, 1)),
+			expected: []expectedDiagnostic{{definition.GetAttr("routes"), `The route of the path "/api" uses the port 5000, which is not declared in ports.`}},
+		},
+		{
+			name:     "duplicate route path",
+			config:   config(strings.Replace(valid, `{"path": "/api", "port": 4000}`, `{"path": "/", "port": 4000}`, 1)),
+			expected: []expectedDiagnostic{{definition.GetAttr("routes"), `The path "/" is routed more than once.`}},
+		},
+		{
+			name:     "min greater than max",
+			config:   config(strings.Replace(valid, `{"min": 1, "max": 2}`, `{"min": 3, "max": 2}`, 1)),
+			expected: []expectedDiagnostic{{definition.GetAttr("scalings").IndexInt(0).GetAttr("min"), "min 3 is greater than max 2."}},
+		},
+		{
+			name:     "value and secret",
+			config:   config(strings.Replace(valid, `{"key": "FOO", "value": "bar"}`, `{"key": "FOO", "value": "bar", "secret": "token"}`, 1)),
+			expected: []expectedDiagnostic{{definition.GetAttr("env"), "The variable FOO sets both value and secret."}},
+		},
+		{
+			name:     "duplicate env key",
+			config:   config(strings.Replace(valid, `{"key": "TOKEN", "secret": "token"}`, `{"key": "FOO", "secret": "token"}`, 1)),
+			expected: []expectedDiagnostic{{definition.GetAttr("env"), "The variable FOO is defined more than once."}},
+		},
+		{
+			name: "several errors",
+			config: config(strings.Replace(strings.Replace(valid, `{"min": 1, "max": 2}`, `{"min": 3, "max": 2}`, 1),
+				`{"key": "TOKEN", "secret": "token"}`, `{"key": "FOO", "secret": "token"}`, 1)),
+			expected: []expectedDiagnostic{
+				{definition.GetAttr("scalings").IndexInt(0).GetAttr("min"), "min 3 is greater than max 2."},
+				{definition.GetAttr("env"), "The variable FOO is defined more than once."},
+			},
+		},
+		{
+			name:   "unknown ports",
+			config: unknown(config(strings.Replace(valid, `{"path": "/api", "port": 4000}`, `{"path": "/api", "port": 5000}`, 1)), "ports"),
+		},
+		{
+			name:   "unknown secret",
+			config: unknown(config(strings.Replace(valid, `{"key": "FOO", "value": "bar"}`, `{"key": "FOO", "value": "bar", "secret": "token"}`, 1)), "secret"),
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			resp := &schema.ValidateResourceConfigFuncResponse{}
+			resourceKoyebServiceValidateDefinition(context.Background(), schema.ValidateResourceConfigFuncRequest{RawConfig: c.config}, resp)
+
+			if len(resp.Diagnostics) != len(c.expected) {
+				t.Fatalf("expected %d diagnostics, got %v", len(c.expected), resp.Diagnostics)
+			}
+			for i, expected := range c.expected {
+				d := resp.Diagnostics[i]
+				if d.Severity != diag.Error || d.Detail != expected.detail || !d.AttributePath.Equals(expected.path) {
+					t.Errorf("expected an error on %#v with the detail %q, got %#v", expected.path, expected.detail, d)
+				}
+			}
+		})
+	}
+}
+
+func TestResourceKoyebServiceCustomizeDiff_AppChange(t *testing.T) {
+	ctx := context.Background()
+
+	server := httptest.NewServer(newFakeAPI())
+	t.Cleanup(server.Close)
+	t.Setenv("KOYEB_API_URL", server.URL)
+	t.Setenv("KOYEB_TOKEN", fakeAPIToken)
+
+	provider := newProvider("test", http.DefaultTransport)()
+	if diags := provider.Configure(ctx, terraform.NewResourceConfigRaw(nil)); diags.HasError() {
+		t.Fatalf("unexpected error: %v", diags)
+	}
+	client := provider.Meta().(*Client)
+
+	appIds := map[string]string{}
+	for _, name := range []string{"app", "other"} {
+		res, _, err := client.AppsApi.CreateApp(ctx).Body(koyeb.CreateApp{Name: toOpt(name)}).Execute()
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		appIds[name] = res.App.GetId()
+	}
+
+	serviceType := resourceKoyebService().CoreConfigSchema().ImpliedType()
+	value := func(attributes string, unknownAppId bool) *tfprotov5.DynamicValue {
+		v, err := ctyjson.Unmarshal([]byte(`{
+			`+attributes+`,
+			"definition": [{
+				"name": "main",
+				"docker": [{"image": "koyeb/demo"}],
+				"ports": [{"port": 3000, "protocol": "http"}],
+				"instance_types": [{"type": "micro"}],
+				"scalings": [{"min": 1, "max": 1}],
+				"regions": ["par"]
+			}]
+		}`), serviceType)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if unknownAppId {
+			attributes := v.AsValueMap()
+			attributes["app_id"] = cty.UnknownVal(cty.String)
+			v = cty.ObjectVal(attributes)
+		}
+
+		packed, err := msgpack.Marshal(v, serviceType)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		return &tfprotov5.DynamicValue{MsgPack: packed}
+	}
+
+	deletedAppId := "00000000-0000-4000-8000-00000000dead"
+
+	cases := []struct {
+		name         string
+		config       string
+		priorAppId   string
+		unknownAppId bool
+		replace      string
+	}{
+		{name: "unchanged", config: `"app_name": "app"`},
+		{name: "rename the app in the same apply", config: `"app_name": "renamed"`},
+		{name: "move to an existing app", config: `"app_name": "other"`, replace: "app_name"},
+		{name: "rename a deleted app", config: `"app_name": "renamed"`, priorAppId: deletedAppId, replace: "app_name"},
+		{name: "rename the app with its ID", config: `"app_name": "renamed", "app_id": "` + appIds["app"] + `"`},
+		{name: "move to a new app with its ID", config: `"app_name": "new", "app_id": null`, unknownAppId: true, replace: "app_id"},
+		{name: "move to an existing app with its ID", config: `"app_name": "other", "app_id": "` + appIds["other"] + `"`, replace: "app_id"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			priorAppId := appIds["app"]
+			if c.priorAppId != "" {
+				priorAppId = c.priorAppId
+			}
+			prior := `"id": "00000000-0000-4000-8000-000000000000", "app_name": "app", "app_id": "` + priorAppId + `"`
+
+			proposed := c.config
+			if !strings.Contains(proposed, "app_id") {
+				proposed += `, "app_id": "` + priorAppId + `"`
+			}
+
+			resp, err := schema.NewGRPCProviderServer(provider).PlanResourceChange(ctx, &tfprotov5.PlanResourceChangeRequest{
+				TypeName:         "koyeb_service",
+				PriorState:       value(prior, false),
+				ProposedNewState: value(`"id": "00000000-0000-4000-8000-000000000000", `+proposed, c.unknownAppId),
+				Config:           value(c.config, c.unknownAppId),
+			})
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			for _, d := range resp.Diagnostics {
+				if d.Severity == tfprotov5.DiagnosticSeverityError {
+					t.Fatalf("unexpected error: %s: %s", d.Summary, d.Detail)
+				}
+			}
+
+			// The SDK also lists the computed id of a replaced resource
+			replaced := []string{}
+			for _, p := range resp.RequiresReplace {
+				if !p.Equal(tftypes.NewAttributePath().WithAttributeName("id")) {
+					replaced = append(replaced, p.String())
+				}
+			}
+
+			expected := []string{}
+			if c.replace != "" {
+				expected = append(expected, tftypes.NewAttributePath().WithAttributeName(c.replace).String())
+			}
+			if !reflect.DeepEqual(replaced, expected) {
+				t.Errorf("expected the replacement to be planned by %v, got %v", expected, replaced)
+			}
+		})
+	}
 }
 
 func TestAccKoyebService_Basic(t *testing.T) {
@@ -52,9 +799,9 @@ func TestAccKoyebService_Basic(t *testing.T) {
 	appName := randomTestName()
 
 	resource.ParallelTest(t, resource.TestCase{
-		PreCheck:          func() { testAccPreCheck(t) },
-		ProviderFactories: testAccProviderFactories,
-		CheckDestroy:      testAccCheckKoyebServiceDestroy,
+		PreCheck:                 func() { testAccPreCheck(t) },
+		ProtoV5ProviderFactories: testAccProtoV5ProviderFactories,
+		CheckDestroy:             testAccCheckKoyebServiceDestroy,
 		Steps: []resource.TestStep{
 			{
 				Config: fmt.Sprintf(testAccCheckKoyebServiceConfig_basic_docker, appName, appName),
@@ -69,9 +816,9 @@ func TestAccKoyebService_Basic(t *testing.T) {
 					resource.TestCheckResourceAttrSet("koyeb_service.bar", "version"),
 					resource.TestCheckResourceAttrSet("koyeb_service.bar", "status"),
 					resource.TestCheckResourceAttrSet("koyeb_service.bar", "messages"),
-					resource.TestCheckResourceAttrSet("koyeb_service.bar", "paused_at"),
-					resource.TestCheckResourceAttrSet("koyeb_service.bar", "resumed_at"),
-					resource.TestCheckResourceAttrSet("koyeb_service.bar", "terminated_at"),
+					resource.TestCheckNoResourceAttr("koyeb_service.bar", "paused_at"),
+					resource.TestCheckNoResourceAttr("koyeb_service.bar", "resumed_at"),
+					resource.TestCheckNoResourceAttr("koyeb_service.bar", "terminated_at"),
 					resource.TestCheckResourceAttrSet("koyeb_service.bar", "latest_deployment"),
 				),
 			},
@@ -88,9 +835,9 @@ func TestAccKoyebService_Basic(t *testing.T) {
 					resource.TestCheckResourceAttrSet("koyeb_service.bar", "version"),
 					resource.TestCheckResourceAttrSet("koyeb_service.bar", "status"),
 					resource.TestCheckResourceAttrSet("koyeb_service.bar", "messages"),
-					resource.TestCheckResourceAttrSet("koyeb_service.bar", "paused_at"),
-					resource.TestCheckResourceAttrSet("koyeb_service.bar", "resumed_at"),
-					resource.TestCheckResourceAttrSet("koyeb_service.bar", "terminated_at"),
+					resource.TestCheckNoResourceAttr("koyeb_service.bar", "paused_at"),
+					resource.TestCheckNoResourceAttr("koyeb_service.bar", "resumed_at"),
+					resource.TestCheckNoResourceAttr("koyeb_service.bar", "terminated_at"),
 					resource.TestCheckResourceAttrSet("koyeb_service.bar", "latest_deployment"),
 				),
 			},
@@ -98,15 +845,112 @@ func TestAccKoyebService_Basic(t *testing.T) {
 	})
 }
 
+func TestAccKoyebService_AppRename(t *testing.T) {
+	var service koyeb.Service
+	appName := randomTestName()
+	newAppName := randomTestName()
+
+	resource.ParallelTest(t, resource.TestCase{
+		PreCheck:                 func() { testAccPreCheck(t) },
+		ProtoV5ProviderFactories: testAccProtoV5ProviderFactories,
+		CheckDestroy:             testAccCheckKoyebServiceDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: fmt.Sprintf(testAccCheckKoyebServiceConfig_app_reference, appName),
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckKoyebServiceExists("koyeb_service.bar", &service),
+					resource.TestCheckResourceAttr("koyeb_service.bar", "app_name", appName),
+				),
+			},
+			{
+				Config: fmt.Sprintf(testAccCheckKoyebServiceConfig_app_reference, newAppName),
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckKoyebServiceNotReplaced("koyeb_service.bar", &service),
+					resource.TestCheckResourceAttr("koyeb_service.bar", "app_name", newAppName),
+				),
+			},
+		},
+	})
+}
+
+func TestAccKoyebService_MoveToNewApp(t *testing.T) {
+	var service koyeb.Service
+	appName := randomTestName()
+	newAppName := randomTestName()
+
+	resource.ParallelTest(t, resource.TestCase{
+		PreCheck:                 func() { testAccPreCheck(t) },
+		ProtoV5ProviderFactories: testAccProtoV5ProviderFactories,
+		CheckDestroy:             testAccCheckKoyebServiceDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: fmt.Sprintf(testAccCheckKoyebServiceConfig_app_move, appName, "", "foo"),
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckKoyebServiceExists("koyeb_service.bar", &service),
+					resource.TestCheckResourceAttrPair("koyeb_service.bar", "app_id", "koyeb_app.foo", "id"),
+				),
+			},
+			{
+				// The new app is created in the same apply, its unknown ID
+				// replaces the service
+				Config: fmt.Sprintf(testAccCheckKoyebServiceConfig_app_move, appName, fmt.Sprintf(`resource "koyeb_app" "new" { name = "%s" }`, newAppName), "new"),
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckKoyebServiceReplaced("koyeb_service.bar", &service),
+					resource.TestCheckResourceAttr("koyeb_service.bar", "app_name", newAppName),
+					resource.TestCheckResourceAttrPair("koyeb_service.bar", "app_id", "koyeb_app.new", "id"),
+				),
+			},
+		},
+	})
+}
+
+func testAccCheckKoyebServiceNotReplaced(n string, service *koyeb.Service) resource.TestCheckFunc {
+	return func(s *terraform.State) error {
+		rs, ok := s.RootModule().Resources[n]
+
+		if !ok {
+			return fmt.Errorf("Not found: %s", n)
+		}
+
+		if rs.Primary.ID != service.GetId() {
+			return fmt.Errorf("Service was replaced: %s != %s", rs.Primary.ID, service.GetId())
+		}
+
+		return nil
+	}
+}
+
+func testAccCheckKoyebServiceReplaced(n string, service *koyeb.Service) resource.TestCheckFunc {
+	return func(s *terraform.State) error {
+		rs, ok := s.RootModule().Resources[n]
+
+		if !ok {
+			return fmt.Errorf("Not found: %s", n)
+		}
+
+		if rs.Primary.ID == service.GetId() {
+			return fmt.Errorf("Service was not replaced: %s", rs.Primary.ID)
+		}
+
+		return nil
+	}
+}
+
 func testAccCheckKoyebServiceDestroy(s *terraform.State) error {
-	client := testAccProvider.Meta().(*koyeb.APIClient)
+	client := testAccProvider.Meta().(*Client)
 	targetStatus := []string{"DELETED", "DELETING"}
 	for _, rs := range s.RootModule().Resources {
 		if rs.Type != "koyeb_service" {
 			continue
 		}
 
-		err := waitForResourceStatus(client.ServicesApi.GetService(context.Background(), rs.Primary.ID).Execute, "Service", targetStatus, 1, false)
+		waiter := serviceStatusWaiter(client, rs.Primary.ID)
+		waiter.Target = targetStatus
+		waiter.NotFoundIsTarget = true
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		_, err := waiter.Wait(ctx)
+		cancel()
 		if err != nil {
 			return fmt.Errorf("Service still exists: %s ", err)
 		}
@@ -128,7 +972,7 @@ func testAccCheckKoyebServiceExists(n string, service *koyeb.Service) resource.T
 			return fmt.Errorf("No Record ID is set")
 		}
 
-		client := testAccProvider.Meta().(*koyeb.APIClient)
+		client := testAccProvider.Meta().(*Client)
 
 		res, _, err := client.ServicesApi.GetService(context.Background(), rs.Primary.ID).Execute()
 
@@ -225,3 +1069,68 @@ resource "koyeb_service" "bar" {
 	  koyeb_app.foo
 	]
 }`
+
+const testAccCheckKoyebServiceConfig_app_reference = `
+resource "koyeb_app" "foo" {
+	name = "%s"
+}
+
+resource "koyeb_service" "bar" {
+	app_name = koyeb_app.foo.name
+	definition {
+		name = "main"
+		instance_types {
+		  type = "micro"
+		}
+		ports {
+		  port     = 3000
+		  protocol = "http"
+		}
+		scalings {
+		  min = 1
+		  max = 1
+		}
+		routes {
+		  path = "/"
+		  port = 3000
+		}
+		regions = ["par"]
+		docker {
+		  image = "koyeb/demo"
+		}
+	}
+}`
+
+const testAccCheckKoyebServiceConfig_app_move = `
+resource "koyeb_app" "foo" {
+	name = "%s"
+}
+
+%s
+
+resource "koyeb_service" "bar" {
+	app_name = koyeb_app.%[3]s.name
+	app_id   = koyeb_app.%[3]s.id
+	definition {
+		name = "main"
+		instance_types {
+		  type = "micro"
+		}
+		ports {
+		  port     = 3000
+		  protocol = "http"
+		}
+		scalings {
+		  min = 1
+		  max = 1
+		}
+		routes {
+		  path = "/"
+		  port = 3000
+		}
+		regions = ["par"]
+		docker {
+		  image = "koyeb/demo"
+		}
+	}
+}`
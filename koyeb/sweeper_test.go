@@ -1,16 +1,45 @@
 package koyeb
 
 import (
+	"context"
 	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/hashicorp/go-multierror"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
 	"github.com/koyeb/koyeb-api-client-go/api/v1/koyeb"
+	"golang.org/x/exp/slices"
 )
 
 func TestMain(m *testing.M) {
+	// The server is left running until the tests exit
+	if os.Getenv("KOYEB_API_URL") == fakeAPIURL {
+		server := httptest.NewServer(newFakeAPI())
+		os.Setenv("KOYEB_API_URL", server.URL)
+
+		if os.Getenv("KOYEB_TOKEN") == "" {
+			os.Setenv("KOYEB_TOKEN", fakeAPIToken)
+		}
+	}
+
+	if err := testAccVCR.validate(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	// Replayed requests are never sent, any token does
+	if testAccVCR.mode == vcrModeReplay && os.Getenv("KOYEB_TOKEN") == "" {
+		os.Setenv("KOYEB_TOKEN", fakeAPIToken)
+	}
+
 	resource.TestMain(m)
 }
 
@@ -22,16 +51,185 @@ func sharedConfig() (interface{}, error) {
 	p := schema.Provider{}
 	userAgent := p.UserAgent("terraform-provider-koyeb", "test")
 
-	apiHost := os.Getenv("KOYEB_API_URL")
-	if apiHost == "" {
-		apiHost = "app.koyeb.com"
-	}
-
 	koyebClientConfig := koyeb.NewConfiguration()
+	if err := setAPIURL(koyebClientConfig, os.Getenv("KOYEB_API_URL")); err != nil {
+		return nil, err
+	}
 	koyebClientConfig.DefaultHeader["Authorization"] = "Bearer " + os.Getenv("KOYEB_TOKEN")
 	koyebClientConfig.UserAgent = userAgent
 
-	client := koyeb.NewAPIClient(koyebClientConfig)
+	return newClient(koyeb.NewAPIClient(koyebClientConfig)), nil
+}
+
+// sweepTimeout bounds the wait for the resources deleted by a sweeper.
+const sweepTimeout = 10 * time.Minute
+
+// sweepList pages through a collection with list until every item is listed.
+// list is called with the limit and offset of the page, and returns the page
+// and the number of items in the collection.
+func sweepList[T any](list func(limit string, offset string) ([]T, int64, error)) ([]T, error) {
+	items := []T{}
+	limit := 100
+
+	for offset := 0; ; offset += limit {
+		page, count, err := list(strconv.Itoa(limit), strconv.Itoa(offset))
+		if err != nil {
+			return nil, err
+		}
+
+		items = append(items, page...)
+
+		if len(page) < limit || int64(len(items)) >= count {
+			return items, nil
+		}
+	}
+}
+
+// sweepApps returns the names of all the apps, indexed by ID.
+func sweepApps(ctx context.Context, client *Client) (map[string]string, error) {
+	apps, err := sweepList(func(limit string, offset string) ([]koyeb.AppListItem, int64, error) {
+		res, _, err := client.AppsApi.ListApps(ctx).Limit(limit).Offset(offset).Execute()
+		return res.GetApps(), res.GetCount(), err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error listing apps: %w", err)
+	}
+
+	names := map[string]string{}
+	for _, a := range apps {
+		names[a.GetId()] = a.GetName()
+	}
+
+	return names, nil
+}
 
-	return client, nil
+// sweepDeleteServices deletes the services, indexed by ID, and waits until
+// they are deleted. Services which are already gone are skipped.
+func sweepDeleteServices(ctx context.Context, client *Client, services map[string]string) error {
+	var result *multierror.Error
+	deleting := map[string]string{}
+
+	for id, name := range services {
+		log.Printf("Destroying service %s", name)
+
+		_, resp, err := client.ServicesApi.DeleteService(ctx, id).Execute()
+		if err != nil && !sweepNotFound(resp) {
+			result = multierror.Append(result, fmt.Errorf("error deleting service %s: %w", name, err))
+			continue
+		}
+
+		deleting[id] = name
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, sweepTimeout)
+	defer cancel()
+
+	for id, name := range deleting {
+		waiter := serviceStatusWaiter(client, id)
+		waiter.Target = []string{string(koyeb.SERVICESTATUS_DELETED)}
+		waiter.NotFoundIsTarget = true
+
+		if _, err := waiter.Wait(ctx); err != nil {
+			result = multierror.Append(result, fmt.Errorf("error waiting for service %s to be deleted: %w", name, err))
+		}
+	}
+
+	return result.ErrorOrNil()
+}
+
+func sweepNotFound(resp *http.Response) bool {
+	return resp != nil && resp.StatusCode == http.StatusNotFound
+}
+
+func isTestName(name string) bool {
+	return strings.HasPrefix(name, testNamePrefix)
+}
+
+func TestSweepers(t *testing.T) {
+	ctx := context.Background()
+
+	server := httptest.NewServer(newFakeAPI())
+	t.Cleanup(server.Close)
+	t.Setenv("KOYEB_API_URL", server.URL)
+	t.Setenv("KOYEB_TOKEN", fakeAPIToken)
+
+	meta, err := sharedConfig()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	client := meta.(*Client)
+
+	for _, appName := range []string{testNamePrefix + "app", "app"} {
+		app, _, err := client.AppsApi.CreateApp(ctx).Body(koyeb.CreateApp{Name: toOpt(appName)}).Execute()
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		_, _, err = client.ServicesApi.CreateService(ctx).Body(koyeb.CreateService{
+			AppId:      app.App.Id,
+			Definition: &koyeb.DeploymentDefinition{Name: toOpt("main"), Docker: &koyeb.DockerSource{Image: toOpt("koyeb/demo")}},
+		}).Execute()
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		_, _, err = client.DomainsApi.CreateDomain(ctx).Body(koyeb.CreateDomain{Name: toOpt(appName + ".com"), AppId: app.App.Id}).Execute()
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+
+	// More secrets than fit in a page
+	for i := 0; i < 150; i++ {
+		_, _, err := client.SecretsApi.CreateSecret(ctx).Body(koyeb.CreateSecret{Name: toOpt(fmt.Sprintf("%ssecret-%d", testNamePrefix, i)), Value: toOpt("value")}).Execute()
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	if _, _, err := client.SecretsApi.CreateSecret(ctx).Body(koyeb.CreateSecret{Name: toOpt("secret"), Value: toOpt("value")}).Execute(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	for _, sweep := range []func(string) error{testSweepService, testSweepDeployment, testSweepDomain, testSweepSecret, testSweepApp} {
+		if err := sweep(""); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+
+	apps, err := sweepApps(ctx, client)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	services, err := client.ListServices(ctx, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	domains, _, err := client.DomainsApi.ListDomains(ctx).Limit("100").Execute()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	secrets, _, err := client.SecretsApi.ListSecrets(ctx).Limit("100").Execute()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	remaining := []string{}
+	for _, name := range apps {
+		remaining = append(remaining, "app "+name)
+	}
+	for _, s := range services {
+		remaining = append(remaining, "service "+serviceSlug(apps[s.GetAppId()], s.GetName()))
+	}
+	for _, d := range domains.GetDomains() {
+		remaining = append(remaining, "domain "+d.GetName())
+	}
+	for _, s := range secrets.GetSecrets() {
+		remaining = append(remaining, "secret "+s.GetName())
+	}
+	slices.Sort(remaining)
+
+	expected := []string{"app app", "domain app-fake-organization.koyeb.app", "domain app.com", "secret secret", "service app/main"}
+	if !slices.Equal(remaining, expected) {
+		t.Errorf("expected %v to remain, got %v", expected, remaining)
+	}
 }
@@ -0,0 +1,229 @@
+package koyeb
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+	"golang.org/x/exp/slices"
+)
+
+var errRequestNotReplayable = errors.New("request body can't be replayed for a retry")
+
+// retryTransport retries requests that failed because of throttling or a
+// transient server error, waiting with an exponential backoff between attempts.
+type retryTransport struct {
+	next       http.RoundTripper
+	maxRetries int
+	minWait    time.Duration
+	maxWait    time.Duration
+}
+
+func newRetryTransport(next http.RoundTripper, maxRetries int, maxWait time.Duration) *retryTransport {
+	return &retryTransport{
+		next:       next,
+		maxRetries: maxRetries,
+		minWait:    time.Second,
+		maxWait:    maxWait,
+	}
+}
+
+var idempotentMethods = []string{
+	http.MethodGet,
+	http.MethodHead,
+	http.MethodOptions,
+	http.MethodPut,
+	http.MethodDelete,
+}
+
+var retryableStatusCodes = []int{
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+// RoundTrip sends the request, and a clone of it with a fresh body for each
+// retry, since a RoundTripper must not modify the request it is given.
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		attemptReq := req
+		if attempt > 0 {
+			attemptReq = req.Clone(req.Context())
+
+			if req.Body != nil && req.Body != http.NoBody {
+				if req.GetBody == nil {
+					return nil, errRequestNotReplayable
+				}
+
+				body, err := req.GetBody()
+				if err != nil {
+					return nil, err
+				}
+				attemptReq.Body = body
+			}
+		}
+
+		resp, err := t.next.RoundTrip(attemptReq)
+
+		if attempt >= t.maxRetries || !t.shouldRetry(req, resp, err) {
+			return resp, err
+		}
+
+		wait := t.backoff(attempt, resp)
+		if resp != nil {
+			tflog.SubsystemDebug(req.Context(), apiLogSubsystem, "Retrying API request", map[string]interface{}{
+				"http_method": req.Method,
+				"http_path":   req.URL.Path,
+				"http_status": resp.StatusCode,
+				"retry_in":    wait.String(),
+				"attempt":     fmt.Sprintf("%d/%d", attempt+1, t.maxRetries),
+			})
+			// Drain the body so the connection can be reused
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		} else {
+			tflog.SubsystemDebug(req.Context(), apiLogSubsystem, "Retrying API request", map[string]interface{}{
+				"http_method": req.Method,
+				"http_path":   req.URL.Path,
+				"error":       err.Error(),
+				"retry_in":    wait.String(),
+				"attempt":     fmt.Sprintf("%d/%d", attempt+1, t.maxRetries),
+			})
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+	}
+}
+
+func (t *retryTransport) shouldRetry(req *http.Request, resp *http.Response, err error) bool {
+	if req.Context().Err() != nil {
+		return false
+	}
+
+	// Throttled requests were not processed, so they are safe to retry
+	// whatever their method
+	if resp != nil && resp.StatusCode == http.StatusTooManyRequests {
+		return true
+	}
+
+	if !slices.Contains(idempotentMethods, req.Method) {
+		return false
+	}
+
+	if err != nil {
+		return true
+	}
+
+	return slices.Contains(retryableStatusCodes, resp.StatusCode)
+}
+
+// backoff returns how long to wait before the next attempt, honouring the
+// Retry-After header when the server sends one.
+func (t *retryTransport) backoff(attempt int, resp *http.Response) time.Duration {
+	wait := t.maxWait
+	if attempt < 32 {
+		if w := t.minWait << attempt; w > 0 && w < t.maxWait {
+			wait = w
+		}
+	}
+
+	if resp != nil {
+		if retryAfter, ok := parseRetryAfter(resp.Header.Get("Retry-After")); ok {
+			wait = retryAfter
+			if wait > t.maxWait {
+				wait = t.maxWait
+			}
+			if wait < 0 {
+				wait = 0
+			}
+		}
+	}
+
+	return wait
+}
+
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		return time.Until(date), true
+	}
+
+	return 0, false
+}
+
+// concurrencyTransport bounds the number of API requests in flight. A slot is
+// held until the response body is closed.
+type concurrencyTransport struct {
+	next     http.RoundTripper
+	slots    chan struct{}
+	requests int64
+}
+
+func newConcurrencyTransport(next http.RoundTripper, maxConcurrentRequests int) *concurrencyTransport {
+	return &concurrencyTransport{
+		next:  next,
+		slots: make(chan struct{}, maxConcurrentRequests),
+	}
+}
+
+func (t *concurrencyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+
+	select {
+	case t.slots <- struct{}{}:
+	case <-req.Context().Done():
+		return nil, req.Context().Err()
+	}
+
+	n := atomic.AddInt64(&t.requests, 1)
+	tflog.SubsystemDebug(req.Context(), apiLogSubsystem, "Acquired API request slot", map[string]interface{}{
+		"request_number": n,
+		"http_method":    req.Method,
+		"http_path":      req.URL.Path,
+		"slot_wait":      time.Since(start).String(),
+		"in_flight":      fmt.Sprintf("%d/%d", len(t.slots), cap(t.slots)),
+	})
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		<-t.slots
+		return nil, err
+	}
+
+	resp.Body = &releasingBody{ReadCloser: resp.Body, release: func() { <-t.slots }}
+
+	return resp, nil
+}
+
+// releasingBody releases a concurrency slot the first time it is closed.
+type releasingBody struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+func (b *releasingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.release)
+
+	return err
+}
@@ -0,0 +1,229 @@
+package koyeb
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testThrottlingServer fails the first failures requests with the given
+// status code, then answers 200 with the request body echoed back.
+func testThrottlingServer(t *testing.T, failures int32, statusCode int, retryAfter string) (*httptest.Server, *int32) {
+	var calls int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&calls, 1)
+		if n <= failures {
+			if retryAfter != "" {
+				w.Header().Set("Retry-After", retryAfter)
+			}
+			w.WriteHeader(statusCode)
+			return
+		}
+
+		body, _ := io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusOK)
+		w.Write(body)
+	}))
+	t.Cleanup(server.Close)
+
+	return server, &calls
+}
+
+func testRetryClient(maxRetries int) *http.Client {
+	transport := newRetryTransport(http.DefaultTransport, maxRetries, 50*time.Millisecond)
+	transport.minWait = time.Millisecond
+
+	return &http.Client{Transport: transport}
+}
+
+func TestRetryTransport_RetriesThrottledRequests(t *testing.T) {
+	server, calls := testThrottlingServer(t, 2, http.StatusTooManyRequests, "0")
+
+	req, _ := http.NewRequest(http.MethodPost, server.URL, strings.NewReader("payload"))
+	resp, err := testRetryClient(3).Do(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", resp.StatusCode)
+	}
+	if body, _ := io.ReadAll(resp.Body); string(body) != "payload" {
+		t.Fatalf("expected the request body to be replayed, got %q", body)
+	}
+	if *calls != 3 {
+		t.Fatalf("expected 3 calls, got %d", *calls)
+	}
+}
+
+func TestRetryTransport_DoesNotModifyTheRequest(t *testing.T) {
+	server, _ := testThrottlingServer(t, 2, http.StatusTooManyRequests, "0")
+
+	req, _ := http.NewRequest(http.MethodPost, server.URL, strings.NewReader("payload"))
+	body := req.Body
+
+	resp, err := testRetryClient(3).Transport.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	resp.Body.Close()
+
+	if req.Body != body {
+		t.Fatal("expected the body of the request to be left untouched")
+	}
+}
+
+func TestRetryTransport_RetriesIdempotentServerErrors(t *testing.T) {
+	server, calls := testThrottlingServer(t, 1, http.StatusBadGateway, "")
+
+	resp, err := testRetryClient(3).Get(server.URL)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", resp.StatusCode)
+	}
+	if *calls != 2 {
+		t.Fatalf("expected 2 calls, got %d", *calls)
+	}
+}
+
+func TestRetryTransport_DoesNotRetryNonIdempotentServerErrors(t *testing.T) {
+	server, calls := testThrottlingServer(t, 1, http.StatusBadGateway, "")
+
+	req, _ := http.NewRequest(http.MethodPost, server.URL, strings.NewReader("payload"))
+	resp, err := testRetryClient(3).Do(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusBadGateway {
+		t.Fatalf("expected status 502, got %d", resp.StatusCode)
+	}
+	if *calls != 1 {
+		t.Fatalf("expected 1 call, got %d", *calls)
+	}
+}
+
+func TestRetryTransport_GivesUpAfterMaxRetries(t *testing.T) {
+	server, calls := testThrottlingServer(t, 10, http.StatusTooManyRequests, "0")
+
+	resp, err := testRetryClient(2).Get(server.URL)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("expected status 429, got %d", resp.StatusCode)
+	}
+	if *calls != 3 {
+		t.Fatalf("expected 3 calls, got %d", *calls)
+	}
+}
+
+func TestRetryTransport_HonoursContextWhileWaiting(t *testing.T) {
+	server, calls := testThrottlingServer(t, 10, http.StatusTooManyRequests, "3600")
+
+	transport := newRetryTransport(http.DefaultTransport, 3, time.Hour)
+	client := &http.Client{Transport: transport}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	start := time.Now()
+	_, err := client.Do(req)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Fatalf("request was not cancelled while waiting for Retry-After")
+	}
+	if *calls != 1 {
+		t.Fatalf("expected 1 call, got %d", *calls)
+	}
+}
+
+func TestRetryTransport_Backoff(t *testing.T) {
+	transport := newRetryTransport(http.DefaultTransport, 5, 10*time.Second)
+
+	cases := []struct {
+		attempt    int
+		retryAfter string
+		expected   time.Duration
+	}{
+		{0, "", time.Second},
+		{2, "", 4 * time.Second},
+		{5, "", 10 * time.Second},
+		{100, "", 10 * time.Second},
+		{0, "3", 3 * time.Second},
+		{0, "120", 10 * time.Second},
+		{0, "invalid", time.Second},
+	}
+
+	for _, c := range cases {
+		resp := &http.Response{Header: http.Header{}}
+		if c.retryAfter != "" {
+			resp.Header.Set("Retry-After", c.retryAfter)
+		}
+
+		if got := transport.backoff(c.attempt, resp); got != c.expected {
+			t.Errorf("backoff(%d, %q) = %s, expected %s", c.attempt, c.retryAfter, got, c.expected)
+		}
+	}
+}
+
+func TestConcurrencyTransport_LimitsRequestsInFlight(t *testing.T) {
+	var inFlight, maxInFlight int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+
+		for {
+			max := atomic.LoadInt32(&maxInFlight)
+			if n <= max || atomic.CompareAndSwapInt32(&maxInFlight, max, n) {
+				break
+			}
+		}
+
+		time.Sleep(10 * time.Millisecond)
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+
+	client := &http.Client{Transport: newConcurrencyTransport(http.DefaultTransport, 2)}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			resp, err := client.Get(server.URL)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}()
+	}
+	wg.Wait()
+
+	if maxInFlight > 2 {
+		t.Fatalf("expected at most 2 requests in flight, got %d", maxInFlight)
+	}
+}
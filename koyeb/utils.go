@@ -1,12 +1,14 @@
 package koyeb
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"math/rand"
 	_nethttp "net/http"
+	"strings"
 	"time"
 
-	"github.com/koyeb/koyeb-api-client-go/api/v1/koyeb"
 	"golang.org/x/exp/slices"
 )
 
@@ -14,37 +16,128 @@ func toOpt[T any](v T) *T {
 	return &v
 }
 
-func waitForResourceStatus[T any](fn func() (T, *_nethttp.Response, error), resourceName string, targetStatus []string, timeout time.Duration, throwErrorIfNotFound bool) error {
+// flattenTime formats a timestamp returned by the API as RFC3339. Timestamps
+// omitted by the API, or never set, are flattened to null.
+func flattenTime(t *time.Time, ok bool) interface{} {
+	if !ok || t == nil || t.IsZero() {
+		return nil
+	}
+
+	return t.UTC().Format(time.RFC3339)
+}
+
+// parseLegacyTime parses a timestamp formatted by time.Time.String, as stored
+// in the states written before the timestamps were flattened as RFC3339.
+func parseLegacyTime(value string) (time.Time, error) {
+	return time.Parse("2006-01-02 15:04:05.999999999 -0700 MST", value)
+}
+
+// statusWaiter polls a resource until it reaches one of the target statuses.
+// Polls are spaced with an exponential backoff with jitter, and the wait is
+// bounded by the context passed to Wait.
+type statusWaiter[T any] struct {
+	// Resource is the resource name used in error messages
+	Resource string
+	// Refresh fetches the resource
+	Refresh func(context.Context) (T, *_nethttp.Response, error)
+	// Status returns the status of the fetched resource
+	Status func(T) string
+	// Messages returns the status messages of the fetched resource, if any
+	Messages func(T) []string
+
+	Pending []string
+	Target  []string
+	Failure []string
+
+	// NotFoundIsTarget treats a 404 as reaching the target, which is what
+	// waiting for a deletion usually wants.
+	NotFoundIsTarget bool
+
+	MinInterval time.Duration
+	MaxInterval time.Duration
+}
+
+func (w statusWaiter[T]) Wait(ctx context.Context) (T, error) {
+	var res T
 	var status string
-	now := time.Now()
-	retryInterval := 5 * time.Second
-	timeoutAt := time.Minute * timeout
+	var messages []string
+
+	interval := w.MinInterval
+	if interval == 0 {
+		interval = time.Second
+	}
+	maxInterval := w.MaxInterval
+	if maxInterval == 0 {
+		maxInterval = 10 * time.Second
+	}
 
-	for time.Since(now) < timeoutAt {
-		res, resp, err := fn()
+	for {
+		current, resp, err := w.Refresh(ctx)
 		if err != nil {
-			if resp.StatusCode == 404 && !throwErrorIfNotFound {
-				return nil
+			if ctx.Err() != nil {
+				return res, w.contextError(ctx, status, messages)
 			}
-			return err
+			if resp != nil && resp.StatusCode == 404 {
+				if w.NotFoundIsTarget {
+					return res, nil
+				}
+				return res, fmt.Errorf("%s not found", w.Resource)
+			}
+			return res, err
 		}
 
-		switch v := any(res).(type) {
-		case koyeb.GetServiceReply:
-			status = fmt.Sprintf("%v", v.Service.GetStatus())
-		case koyeb.GetDeploymentReply:
-			status = fmt.Sprintf("%v", v.Deployment.GetStatus())
-		case koyeb.GetDomainReply:
-			status = fmt.Sprintf("%v", v.Domain.GetStatus())
-		default:
-			return errors.New("unknown resource type")
+		res = current
+		status = w.Status(res)
+		if w.Messages != nil {
+			messages = w.Messages(res)
 		}
 
-		if slices.Contains(targetStatus, status) {
-			return nil
+		if slices.Contains(w.Target, status) {
+			return res, nil
+		}
+		if slices.Contains(w.Failure, status) {
+			return res, fmt.Errorf("%s reached status %s: %s", w.Resource, status, strings.Join(messages, " "))
 		}
-		time.Sleep(retryInterval)
+		if len(w.Pending) > 0 && !slices.Contains(w.Pending, status) {
+			return res, fmt.Errorf("%s reached unexpected status %s: %s", w.Resource, status, strings.Join(messages, " "))
+		}
+
+		// Full jitter on the upper half of the interval
+		sleep := interval/2 + time.Duration(rand.Int63n(int64(interval/2)+1))
+
+		select {
+		case <-ctx.Done():
+			return res, w.contextError(ctx, status, messages)
+		case <-time.After(sleep):
+		}
+
+		interval *= 2
+		if interval > maxInterval {
+			interval = maxInterval
+		}
+	}
+}
+
+// contextError reports why the wait ended early: the timeout of the operation
+// or an interruption, such as Ctrl-C, which cancels the context.
+func (w statusWaiter[T]) contextError(ctx context.Context, status string, messages []string) error {
+	reason := "timeout"
+	if errors.Is(ctx.Err(), context.Canceled) {
+		reason = "interrupted"
+	}
+
+	if status == "" {
+		return fmt.Errorf("%s while waiting for %s to reach status %s: %w", reason, w.Resource, strings.Join(w.Target, ", "), ctx.Err())
+	}
+
+	return fmt.Errorf("%s while waiting for %s to reach status %s, last status: %s (%s): %w", reason, w.Resource, strings.Join(w.Target, ", "), status, strings.Join(messages, " "), ctx.Err())
+}
+
+func expandStringMap(m map[string]interface{}) map[string]string {
+	result := make(map[string]string, len(m))
+	for k, v := range m {
+		result[k] = v.(string)
 	}
 
-	return errors.New("resource failed to reach target status after timeout")
+	return result
 }
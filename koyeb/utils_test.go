@@ -0,0 +1,149 @@
+package koyeb
+
+import (
+	"context"
+	"errors"
+	_nethttp "net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testStatusReply struct {
+	status   string
+	messages []string
+}
+
+func testStatusWaiter(replies []testStatusReply, statusCode int) statusWaiter[testStatusReply] {
+	calls := 0
+
+	return statusWaiter[testStatusReply]{
+		Resource: "resource test",
+		Refresh: func(ctx context.Context) (testStatusReply, *_nethttp.Response, error) {
+			if err := ctx.Err(); err != nil {
+				return testStatusReply{}, nil, err
+			}
+			if statusCode != 0 {
+				return testStatusReply{}, &_nethttp.Response{StatusCode: statusCode}, errors.New("request failed")
+			}
+
+			reply := replies[calls]
+			if calls < len(replies)-1 {
+				calls++
+			}
+			return reply, &_nethttp.Response{StatusCode: 200}, nil
+		},
+		Status: func(r testStatusReply) string {
+			return r.status
+		},
+		Messages: func(r testStatusReply) []string {
+			return r.messages
+		},
+		MinInterval: time.Millisecond,
+		MaxInterval: 5 * time.Millisecond,
+	}
+}
+
+func TestStatusWaiter_Target(t *testing.T) {
+	waiter := testStatusWaiter([]testStatusReply{{status: "PENDING"}, {status: "PENDING"}, {status: "ACTIVE"}}, 0)
+	waiter.Pending = []string{"PENDING"}
+	waiter.Target = []string{"ACTIVE"}
+
+	res, err := waiter.Wait(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if res.status != "ACTIVE" {
+		t.Fatalf("expected status ACTIVE, got %s", res.status)
+	}
+}
+
+func TestStatusWaiter_Failure(t *testing.T) {
+	waiter := testStatusWaiter([]testStatusReply{{status: "PENDING"}, {status: "ERROR", messages: []string{"CNAME not found"}}}, 0)
+	waiter.Pending = []string{"PENDING"}
+	waiter.Target = []string{"ACTIVE"}
+	waiter.Failure = []string{"ERROR"}
+
+	_, err := waiter.Wait(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "ERROR") || !strings.Contains(err.Error(), "CNAME not found") {
+		t.Fatalf("expected failure error with messages, got %v", err)
+	}
+}
+
+func TestStatusWaiter_UnexpectedStatus(t *testing.T) {
+	waiter := testStatusWaiter([]testStatusReply{{status: "PAUSED"}}, 0)
+	waiter.Pending = []string{"STARTING"}
+	waiter.Target = []string{"HEALTHY"}
+
+	_, err := waiter.Wait(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "unexpected status PAUSED") {
+		t.Fatalf("expected unexpected status error, got %v", err)
+	}
+}
+
+func TestStatusWaiter_Timeout(t *testing.T) {
+	waiter := testStatusWaiter([]testStatusReply{{status: "DELETING", messages: []string{"Draining"}}}, 0)
+	waiter.Target = []string{"DELETED"}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	_, err := waiter.Wait(ctx)
+	if err == nil || !strings.Contains(err.Error(), "last status: DELETING (Draining)") || !strings.HasPrefix(err.Error(), "timeout") {
+		t.Fatalf("expected timeout error with last status, got %v", err)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the timeout to be wrapped, got %v", err)
+	}
+}
+
+func TestStatusWaiter_Interrupted(t *testing.T) {
+	waiter := testStatusWaiter([]testStatusReply{{status: "DELETING", messages: []string{"Draining"}}}, 0)
+	waiter.Target = []string{"DELETED"}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+
+	_, err := waiter.Wait(ctx)
+	if err == nil || !strings.HasPrefix(err.Error(), "interrupted while waiting for resource test") || !strings.Contains(err.Error(), "last status: DELETING (Draining)") {
+		t.Fatalf("expected interruption error with last status, got %v", err)
+	}
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected the cancellation to be wrapped, got %v", err)
+	}
+}
+
+func TestStatusWaiter_NotFound(t *testing.T) {
+	waiter := testStatusWaiter(nil, 404)
+	waiter.Target = []string{"DELETED"}
+
+	if _, err := waiter.Wait(context.Background()); err == nil {
+		t.Fatal("expected not found error")
+	}
+
+	waiter.NotFoundIsTarget = true
+	if _, err := waiter.Wait(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+}
+
+func TestFlattenTime(t *testing.T) {
+	timestamp := time.Date(2022, 6, 1, 12, 30, 0, 0, time.FixedZone("CEST", 2*60*60))
+	zero := time.Time{}
+
+	cases := []struct {
+		time     *time.Time
+		ok       bool
+		expected interface{}
+	}{
+		{&timestamp, true, "2022-06-01T10:30:00Z"},
+		{&zero, true, nil},
+		{nil, false, nil},
+	}
+
+	for _, c := range cases {
+		if got := flattenTime(c.time, c.ok); got != c.expected {
+			t.Errorf("flattenTime(%v, %t) = %v, expected %v", c.time, c.ok, got, c.expected)
+		}
+	}
+}
@@ -0,0 +1,427 @@
+package koyeb
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const (
+	// vcrModeRecord sends the API requests of the acceptance tests to the API
+	// and records them in cassettes
+	vcrModeRecord = "record"
+	// vcrModeReplay answers the API requests of the acceptance tests with the
+	// recorded cassettes, without network access
+	vcrModeReplay = "replay"
+)
+
+// vcrCassettesDir is the directory of the cassettes, one per acceptance test.
+const vcrCassettesDir = "testdata/cassettes"
+
+// testAccVCR is the transport of the provider used by the acceptance tests.
+// It is set up with the KOYEB_VCR_MODE environment variable.
+var testAccVCR = newVCR(os.Getenv("KOYEB_VCR_MODE"), vcrCassettesDir, http.DefaultTransport)
+
+// vcr records the API requests of the acceptance tests and their responses
+// in cassettes, and replays them. The tests share the provider and its
+// transport, so they run one at a time when recording or replaying.
+//
+// Request bodies and response bodies are sanitized like the API logs, and
+// request headers are not recorded, so cassettes hold neither tokens nor
+// secret values. A replayed request is answered with the first unused
+// interaction with the same method, URL and sanitized body, which keeps the
+// replay deterministic when Terraform sends requests concurrently.
+type vcr struct {
+	mode string
+	dir  string
+	next http.RoundTripper
+
+	// running is held by the test using the current cassette
+	running sync.Mutex
+
+	mu        sync.Mutex
+	cassettes map[string]*vcrCassette
+	current   *vcrCassette
+}
+
+type vcrCassette struct {
+	// Names are the names returned by randomTestName, in order
+	Names        []string          `json:"names"`
+	Interactions []*vcrInteraction `json:"interactions"`
+
+	name      string
+	nextName  int
+	replaying bool
+}
+
+type vcrInteraction struct {
+	Request  vcrRequest  `json:"request"`
+	Response vcrResponse `json:"response"`
+
+	used bool
+}
+
+type vcrRequest struct {
+	Method string `json:"method"`
+	URL    string `json:"url"`
+	Body   string `json:"body,omitempty"`
+}
+
+type vcrResponse struct {
+	StatusCode  int    `json:"status_code"`
+	ContentType string `json:"content_type,omitempty"`
+	Body        string `json:"body,omitempty"`
+}
+
+func newVCR(mode string, dir string, next http.RoundTripper) *vcr {
+	return &vcr{
+		mode:      mode,
+		dir:       dir,
+		next:      next,
+		cassettes: map[string]*vcrCassette{},
+	}
+}
+
+func (v *vcr) validate() error {
+	switch v.mode {
+	case "", vcrModeRecord, vcrModeReplay:
+		return nil
+	}
+
+	return fmt.Errorf("invalid KOYEB_VCR_MODE %q, expected %s or %s", v.mode, vcrModeRecord, vcrModeReplay)
+}
+
+// use sends the API requests of the test to its cassette until it ends. A
+// test without cassette fails when replaying, so a missing recording is not
+// mistaken for a passing test.
+func (v *vcr) use(t *testing.T) {
+	if v.mode == "" {
+		return
+	}
+
+	c, err := v.cassette(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c == nil {
+		t.Fatalf("No cassette recorded for %s in %s, record it with KOYEB_VCR_MODE=%s", t.Name(), v.dir, vcrModeRecord)
+	}
+
+	v.insert(c)
+	t.Cleanup(func() {
+		if err := v.eject(!t.Failed()); err != nil {
+			t.Error(err)
+		}
+	})
+}
+
+// cassette returns the cassette of the test. When recording, a new cassette
+// is started. When replaying, the recorded one is loaded, or nil is returned
+// if there is none.
+func (v *vcr) cassette(name string) (*vcrCassette, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if c, ok := v.cassettes[name]; ok {
+		return c, nil
+	}
+
+	c := &vcrCassette{name: name}
+
+	if v.mode == vcrModeReplay {
+		content, err := os.ReadFile(v.path(name))
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if err := json.Unmarshal(content, c); err != nil {
+			return nil, fmt.Errorf("cannot read cassette %s: %w", v.path(name), err)
+		}
+		c.replaying = true
+	}
+
+	v.cassettes[name] = c
+
+	return c, nil
+}
+
+func (v *vcr) insert(c *vcrCassette) {
+	v.running.Lock()
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.current = c
+}
+
+// eject stops using the current cassette, and writes it when recording and
+// save is set.
+func (v *vcr) eject(save bool) error {
+	defer v.running.Unlock()
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	c := v.current
+	v.current = nil
+
+	if v.mode != vcrModeRecord || !save {
+		return nil
+	}
+
+	content, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(v.dir, 0755); err != nil {
+		return err
+	}
+
+	return os.WriteFile(v.path(c.name), append(content, '\n'), 0644)
+}
+
+func (v *vcr) path(name string) string {
+	return filepath.Join(v.dir, name+".json")
+}
+
+// name returns the next name of the test, recorded in its cassette so it can
+// be replayed. Outside of a test, or when replaying a test without cassette,
+// the generated name is returned.
+func (v *vcr) name(testName string, generate func() string) string {
+	if v.mode == "" || testName == "" {
+		return generate()
+	}
+
+	c, err := v.cassette(testName)
+	if err != nil || c == nil {
+		return generate()
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if c.replaying {
+		if c.nextName < len(c.Names) {
+			c.nextName++
+			return c.Names[c.nextName-1]
+		}
+
+		return generate()
+	}
+
+	name := generate()
+	c.Names = append(c.Names, name)
+
+	return name
+}
+
+func (v *vcr) RoundTrip(req *http.Request) (*http.Response, error) {
+	if v.mode == "" {
+		return v.next.RoundTrip(req)
+	}
+
+	body, err := peekRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	request := vcrRequest{
+		Method: req.Method,
+		URL:    req.URL.RequestURI(),
+		Body:   redactBody(body),
+	}
+
+	v.mu.Lock()
+	c := v.current
+	v.mu.Unlock()
+
+	if v.mode == vcrModeReplay {
+		if c == nil {
+			return nil, fmt.Errorf("no cassette to replay %s %s", request.Method, request.URL)
+		}
+
+		return v.replay(c, req, request)
+	}
+
+	resp, err := v.next.RoundTrip(req)
+	if err != nil || c == nil {
+		return resp, err
+	}
+
+	responseBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(responseBody))
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	c.Interactions = append(c.Interactions, &vcrInteraction{
+		Request: request,
+		Response: vcrResponse{
+			StatusCode:  resp.StatusCode,
+			ContentType: resp.Header.Get("Content-Type"),
+			Body:        redactBody(responseBody),
+		},
+	})
+
+	return resp, nil
+}
+
+// replay answers req with the first unused matching interaction. Reads poll
+// more or less depending on timing, so a read that was recorded fewer times
+// gets the last matching response again.
+func (v *vcr) replay(c *vcrCassette, req *http.Request, request vcrRequest) (*http.Response, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	var last *vcrInteraction
+	var match *vcrInteraction
+
+	for _, interaction := range c.Interactions {
+		if interaction.Request != request {
+			continue
+		}
+
+		last = interaction
+		if !interaction.used {
+			match = interaction
+			break
+		}
+	}
+
+	if match == nil && req.Method == http.MethodGet {
+		match = last
+	}
+	if match == nil {
+		return nil, fmt.Errorf("no interaction recorded in cassette %s for %s %s", c.name, request.Method, request.URL)
+	}
+	match.used = true
+
+	header := http.Header{}
+	if match.Response.ContentType != "" {
+		header.Set("Content-Type", match.Response.ContentType)
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", match.Response.StatusCode, http.StatusText(match.Response.StatusCode)),
+		StatusCode:    match.Response.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(strings.NewReader(match.Response.Body)),
+		ContentLength: int64(len(match.Response.Body)),
+		Request:       req,
+	}, nil
+}
+
+// callingTestName returns the name of the test function in the call stack.
+func callingTestName() string {
+	pcs := make([]uintptr, 32)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(2, pcs)])
+
+	for {
+		frame, more := frames.Next()
+
+		name := frame.Function[strings.LastIndex(frame.Function, ".")+1:]
+		if strings.HasPrefix(name, "Test") {
+			return name
+		}
+
+		if !more {
+			return ""
+		}
+	}
+}
+
+func TestVCR_RecordAndReplay(t *testing.T) {
+	dir := t.TempDir()
+	calls := 0
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"secret": ` + string(body) + `}`))
+	}))
+	t.Cleanup(server.Close)
+
+	send := func(transport http.RoundTripper, value string) (string, error) {
+		req, _ := http.NewRequest(http.MethodPost, server.URL+"/v1/secrets", strings.NewReader(`{"name": "foo", "value": "`+value+`"}`))
+		req.Header.Set("Authorization", "Bearer my-token")
+
+		resp, err := transport.RoundTrip(req)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+
+		body, err := io.ReadAll(resp.Body)
+		return string(body), err
+	}
+
+	recorder := newVCR(vcrModeRecord, dir, http.DefaultTransport)
+	c, _ := recorder.cassette("TestExample")
+	recordedName := recorder.name("TestExample", func() string { return "name-1" })
+
+	recorder.insert(c)
+	if body, err := send(recorder, "my-value"); err != nil || !strings.Contains(body, "my-value") {
+		t.Fatalf("expected the real response while recording, got %s, %v", body, err)
+	}
+	if err := recorder.eject(true); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	content, err := os.ReadFile(filepath.Join(dir, "TestExample.json"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	for _, secret := range []string{"my-value", "my-token"} {
+		if strings.Contains(string(content), secret) {
+			t.Errorf("expected %s to be scrubbed from the cassette:\n%s", secret, content)
+		}
+	}
+
+	replayer := newVCR(vcrModeReplay, dir, nil)
+	c, _ = replayer.cassette("TestExample")
+	if c == nil {
+		t.Fatal("expected the cassette to be loaded")
+	}
+	if name := replayer.name("TestExample", func() string { return "name-2" }); name != recordedName {
+		t.Errorf("expected the recorded name %s, got %s", recordedName, name)
+	}
+
+	replayer.insert(c)
+	defer replayer.eject(false)
+
+	if body, err := send(replayer, "another-value"); err != nil || !strings.Contains(body, `"value":"***"`) {
+		t.Fatalf("expected the recorded response, got %s, %v", body, err)
+	}
+	if _, err := send(replayer, "another-value"); err == nil {
+		t.Fatal("expected an error when the interaction was already replayed")
+	}
+	if calls != 1 {
+		t.Errorf("expected the API to be called once, got %d calls", calls)
+	}
+
+	if c, _ := replayer.cassette("TestMissing"); c != nil {
+		t.Errorf("expected no cassette, got %+v", c)
+	}
+}
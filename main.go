@@ -1,11 +1,13 @@
 package main
 
 import (
+	"context"
 	"flag"
+	"log"
 
 	"github.com/koyeb/terraform-provider-koyeb/koyeb"
 
-	"github.com/hashicorp/terraform-plugin-sdk/v2/plugin"
+	"github.com/hashicorp/terraform-plugin-go/tfprotov5/tf5server"
 )
 
 // Run "go generate" to format example terraform files and generate the docs for the registry/website
@@ -33,11 +35,21 @@ func main() {
 	flag.BoolVar(&debugMode, "debug", false, "set to true to run the provider with support for debuggers like delve")
 	flag.Parse()
 
-	opts := &plugin.ServeOpts{
-		Debug: debugMode,
+	// The SDK and the framework providers are served side by side while the
+	// resources are migrated to the framework
+	muxServer, err := koyeb.NewMuxServer(context.Background(), version)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var serveOpts []tf5server.ServeOpt
 
-		ProviderFunc: koyeb.New(version),
+	if debugMode {
+		serveOpts = append(serveOpts, tf5server.WithManagedDebug())
 	}
 
-	plugin.Serve(opts)
+	err = tf5server.Serve("registry.terraform.io/koyeb/koyeb", muxServer, serveOpts...)
+	if err != nil {
+		log.Fatal(err)
+	}
 }